@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// route: "GET /api/room/requests?sid="
+// the pending join requests of a room with the approval policy, requires a host
+func JoinRequests(w http.ResponseWriter, r *http.Request) {
+	client := getHost(w, r)
+	if client == nil {
+		return
+	}
+
+	requestsJson, err := json.Marshal(client.Hub.Access.Requests())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode join requests json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(requestsJson)
+}
+
+// route: "POST /api/room/requests?sid="
+// form: uid, accept ("true" or "false"), requires a host
+func AnswerJoinRequest(w http.ResponseWriter, r *http.Request) {
+	client := getHost(w, r)
+	if client == nil {
+		return
+	}
+
+	uid, err := uuid.Parse(r.PostFormValue("uid"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	accept, err := strconv.ParseBool(r.PostFormValue("accept"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if err := client.Hub.Access.Answer(uid, accept); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Info().
+		Str("uid", uid.String()).
+		Str("host", client.ID.String()).
+		Bool("accept", accept).
+		Msg("[api] join request answered")
+
+	w.WriteHeader(http.StatusNoContent)
+}
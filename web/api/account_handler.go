@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"main/internal/auth"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// http response of the account, Token and Expiry are set on login
+type accountJson struct {
+	UID    string
+	Email  string
+	Name   string
+	Token  string `json:",omitempty"`
+	Expiry int64  `json:",omitempty"` // unix milli
+}
+
+func writeAccountJson(w http.ResponseWriter, status int, resp accountJson) {
+	respJson, err := json.Marshal(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode account json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(respJson)
+}
+
+// log in the account, the session token is set as the cookie and returned in the response
+func login(w http.ResponseWriter, r *http.Request, status int, account auth.Account) {
+	token, session := auth.SetSessionCookie(w, r, account.UID)
+	resp := accountJson{
+		UID:    account.UID.String(),
+		Email:  account.Email,
+		Name:   account.Name,
+		Token:  token,
+		Expiry: session.Expiry.UnixMilli(),
+	}
+	writeAccountJson(w, status, resp)
+}
+
+// route: "POST /api/account/register"
+// form: email, name, password
+func HandleRegister(w http.ResponseWriter, r *http.Request) {
+	account, err := auth.Accounts.Register(
+		r.PostFormValue("email"),
+		r.PostFormValue("name"),
+		r.PostFormValue("password"),
+	)
+	switch {
+	case err == nil:
+	case errors.Is(err, auth.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, auth.ErrInvalidEmail), errors.Is(err, auth.ErrInvalidName), errors.Is(err, auth.ErrPasswordLength):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		log.Error().Err(err).Msg("[api] failed to register account")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("uid", account.UID.String()).Msg("[api] account registered")
+
+	login(w, r, http.StatusCreated, account)
+}
+
+// route: "POST /api/account/login"
+// form: email, password
+func HandleLogin(w http.ResponseWriter, r *http.Request) {
+	account, err := auth.Accounts.Authenticate(r.PostFormValue("email"), r.PostFormValue("password"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	login(w, r, http.StatusOK, account)
+}
+
+// route: "POST /api/account/logout?all="
+// all is optional, set to true to revoke every session of the account
+func HandleLogout(w http.ResponseWriter, r *http.Request) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	if session, ok := auth.SessionFromRequest(r); ok && all {
+		if err := auth.Accounts.RevokeSessions(session.UID); err != nil {
+			log.Error().Err(err).Msg("[api] failed to revoke sessions")
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+	auth.ClearSessionCookie(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "GET /api/account"
+func HandleAccount(w http.ResponseWriter, r *http.Request) {
+	session, ok := auth.SessionFromRequest(r)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+	account, ok := auth.Accounts.Get(session.UID)
+	if !ok {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	resp := accountJson{
+		UID:   account.UID.String(),
+		Email: account.Email,
+		Name:  account.Name,
+	}
+	writeAccountJson(w, http.StatusOK, resp)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"main/internal/room"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// route: "GET /api/chat?sid="
+// the recent chat messages of the room, from the oldest to the latest
+func ChatHistory(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	chatJson, err := json.Marshal(client.Hub.Chat.List())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode chat json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(chatJson)
+}
+
+// route: "POST /api/chat?sid="
+// form: text, the message is relayed to the room and returned
+func PostChat(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := client.Hub.PostChat(client, r.PostFormValue("text"))
+	switch {
+	case err == nil:
+	case errors.Is(err, room.ErrChatRateLimited):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case errors.Is(err, room.ErrChatTooLong):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msgJson, err := json.Marshal(msg)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode chat json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(msgJson)
+}
+
+// route: "DELETE /api/chat/{id}?sid="
+// requires the host permission
+func DeleteChat(w http.ResponseWriter, r *http.Request) {
+	host := getHost(w, r)
+	if host == nil {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if !host.Hub.DeleteChat(host, id) {
+		http.Error(w, "chat message not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"main/internal/room"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// route: "GET /api/history?sid="
+// the recently played nodes of the room, from the oldest to the latest
+func History(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	historyJson, err := json.Marshal(client.Hub.History.List())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode history json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(historyJson)
+}
+
+// route: "POST /api/history/requeue?sid="
+// form: history_id
+// the node is enqueued again with the stored metadata, queued by the requesting client
+func RequeueHistory(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	historyID, err := strconv.Atoi(r.PostFormValue("history_id"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	entry, ok := client.Hub.History.Get(historyID)
+	if !ok {
+		http.Error(w, "history entry not found", http.StatusNotFound)
+		return
+	}
+
+	node := room.MusicInfo{
+		URL:          entry.URL,
+		InfoJson:     entry.InfoJson,
+		QueuedBy:     client.ID.String(),
+		QueuedByName: client.Name,
+	}
+	if err := client.Hub.Player.Playlist.Enqueue(&node); err != nil {
+		log.Error().Err(err).Msg("[api] Enqueue history error")
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Write([]byte(strconv.Itoa(node.ID)))
+
+	// notify the room without blocking the response
+	go func() {
+		broadcastEnqueued(client, &node)
+		client.SignalMPAdd()
+	}()
+}
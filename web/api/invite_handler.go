@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"main/internal/room"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+type inviteJson struct {
+	room.Invite
+	URL string // path of the join page with the invite
+}
+
+func newInviteJson(hub *room.Hub, invite room.Invite) inviteJson {
+	query := url.Values{}
+	query.Set("rid", base64.RawURLEncoding.EncodeToString(hub.ID[:]))
+	query.Set("invite", invite.Token)
+	return inviteJson{
+		Invite: invite,
+		URL:    "/join?" + query.Encode(),
+	}
+}
+
+// route: "POST /api/invites?sid="
+// form: ttl (e.g. "2h", default 24h), max_uses (0 for unlimited), permission (1, 3 or 7, optional)
+// requires a host
+func CreateInvite(w http.ResponseWriter, r *http.Request) {
+	client := getHost(w, r)
+	if client == nil {
+		return
+	}
+
+	ttl := room.INVITE_DEFAULT_TTL
+	if pTTL := r.PostFormValue("ttl"); pTTL != "" {
+		_ttl, err := time.ParseDuration(pTTL)
+		if err != nil || _ttl <= 0 || _ttl > room.INVITE_MAX_TTL {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = _ttl
+	}
+	maxUses := 0
+	if pMaxUses := r.PostFormValue("max_uses"); pMaxUses != "" {
+		_maxUses, err := strconv.Atoi(pMaxUses)
+		if err != nil || _maxUses < 0 {
+			http.Error(w, "Invalid max_uses", http.StatusBadRequest)
+			return
+		}
+		maxUses = _maxUses
+	}
+	permission := 0
+	if pPermission := r.PostFormValue("permission"); pPermission != "" {
+		_permission, err := strconv.Atoi(pPermission)
+		if err != nil || !room.ValidPermission(_permission) {
+			http.Error(w, "Invalid permission", http.StatusBadRequest)
+			return
+		}
+		permission = _permission
+	}
+
+	hub := client.Hub
+	invite, err := hub.Invites.Create(hub.ID, client.ID, ttl, maxUses, permission)
+	if errors.Is(err, room.ErrTooManyInvites) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	inviteJson, err := json.Marshal(newInviteJson(hub, invite))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode invite json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write(inviteJson)
+}
+
+// route: "GET /api/invites?sid="
+// requires a host
+func ListInvites(w http.ResponseWriter, r *http.Request) {
+	client := getHost(w, r)
+	if client == nil {
+		return
+	}
+
+	invites := client.Hub.Invites.List()
+	list := make([]inviteJson, len(invites))
+	for i, invite := range invites {
+		list[i] = newInviteJson(client.Hub, invite)
+	}
+	listJson, err := json.Marshal(list)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode invite list json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(listJson)
+}
+
+// route: "DELETE /api/invites/{id}?sid="
+// the invite can not be used anymore, joined clients are not affected.
+// requires a host
+func RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	client := getHost(w, r)
+	if client == nil {
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if err := client.Hub.Invites.Revoke(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "POST /api/invites/required?sid="
+// form: required, "true" to restrict the room to invited clients
+// requires a host
+func EditInviteRequired(w http.ResponseWriter, r *http.Request) {
+	client := getHost(w, r)
+	if client == nil {
+		return
+	}
+
+	required, err := strconv.ParseBool(r.PostFormValue("required"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client.Hub.Invites.SetRequired(required)
+	w.WriteHeader(http.StatusNoContent)
+}
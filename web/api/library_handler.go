@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"main/internal/library"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+type libraryTrackJson struct {
+	library.Track
+	URL string // reference accepted by "/api/enqueue" as post_url
+}
+
+// route: "GET /api/library/search?sid=&q="
+func LibrarySearch(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if library.Default == nil {
+		http.Error(w, "library is not configured", http.StatusNotFound)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	tracks := library.Default.Search(query, library.SEARCH_MAX_RESULTS)
+	results := make([]libraryTrackJson, 0, len(tracks))
+	for _, t := range tracks {
+		results = append(results, libraryTrackJson{
+			Track: t,
+			URL:   t.Ref(),
+		})
+	}
+
+	jsonList, err := json.Marshal(results)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode library search json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(jsonList)
+}
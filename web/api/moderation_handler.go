@@ -0,0 +1,298 @@
+package api
+
+import (
+	"encoding/json"
+	"main/internal/room"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// returns the client of the sid query if it has the trusted permission, the error is written otherwise
+func getModerator(w http.ResponseWriter, r *http.Request) *room.Client {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil
+	}
+	if !client.Allowed(room.PERMISSION_TRUSTED) {
+		http.Error(w, "", http.StatusForbidden)
+		return nil
+	}
+	return client
+}
+
+// hosts can moderate anyone but the hosts, others can only moderate a lower permission.
+// The permission of a client which is not connected is unknown, only the hosts can moderate it
+func canModerate(moderator *room.Client, uid uuid.UUID, target *room.Client) bool {
+	if uid == moderator.ID {
+		return false
+	}
+	permission := moderator.CurrentPermission()
+	if target == nil {
+		return permission == room.PERMISSION_HOST
+	}
+	targetPermission := target.CurrentPermission()
+	if targetPermission == room.PERMISSION_HOST {
+		return false
+	}
+	return permission == room.PERMISSION_HOST || permission > targetPermission
+}
+
+// returns the client of the uid in the hub, nil if it is not connected
+func hubClient(hub *room.Hub, uid uuid.UUID) *room.Client {
+	room.ClientMapMutex.RLock()
+	defer room.ClientMapMutex.RUnlock()
+
+	client, ok := room.ClientMap[uid]
+	if !ok || client.Hub != hub {
+		return nil
+	}
+	return client
+}
+
+// route: "POST /api/room/kick?sid="
+// form: uid, the client is disconnected and can join again, requires the trusted permission
+func KickClient(w http.ResponseWriter, r *http.Request) {
+	moderator := getModerator(w, r)
+	if moderator == nil {
+		return
+	}
+
+	uid, err := uuid.Parse(r.PostFormValue("uid"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	target := hubClient(moderator.Hub, uid)
+	if target == nil {
+		http.Error(w, "client not found", http.StatusNotFound)
+		return
+	}
+	if !canModerate(moderator, uid, target) {
+		http.Error(w, "", http.StatusForbidden)
+		return
+	}
+
+	moderator.Hub.Kick(target, room.EVENT_KICK, "kicked from the room")
+	log.Info().
+		Str("uid", uid.String()).
+		Str("by", moderator.ID.String()).
+		Str("rid", moderator.Hub.B64ID()).
+		Msg("[api] client kicked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "POST /api/room/ban?sid="
+// form: uid, the uid can not join until the room is closed, requires the trusted permission
+func BanClient(w http.ResponseWriter, r *http.Request) {
+	moderator := getModerator(w, r)
+	if moderator == nil {
+		return
+	}
+
+	uid, err := uuid.Parse(r.PostFormValue("uid"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	hub := moderator.Hub
+	target := hubClient(hub, uid)
+	if !canModerate(moderator, uid, target) {
+		http.Error(w, "", http.StatusForbidden)
+		return
+	}
+
+	username := ""
+	if target != nil {
+		username = target.Name
+	}
+	hub.Bans.Add(uid, username, moderator.ID)
+	// deny the pending join request of the uid
+	hub.Access.Answer(uid, false)
+	if target != nil {
+		hub.Kick(target, room.EVENT_BAN, "banned from the room")
+	}
+	log.Info().
+		Str("uid", uid.String()).
+		Str("by", moderator.ID.String()).
+		Str("rid", hub.B64ID()).
+		Msg("[api] client banned")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "GET /api/room/bans?sid="
+// requires the trusted permission
+func ListBans(w http.ResponseWriter, r *http.Request) {
+	moderator := getModerator(w, r)
+	if moderator == nil {
+		return
+	}
+
+	bansJson, err := json.Marshal(moderator.Hub.Bans.List())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode ban list json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bansJson)
+}
+
+// route: "DELETE /api/room/bans/{uid}?sid="
+// requires the trusted permission
+func Unban(w http.ResponseWriter, r *http.Request) {
+	moderator := getModerator(w, r)
+	if moderator == nil {
+		return
+	}
+
+	uid, err := uuid.Parse(r.PathValue("uid"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if !moderator.Hub.Bans.Remove(uid) {
+		http.Error(w, "ban not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "POST /api/room/host?sid="
+// form: uid, the host role of the requesting host is handed to the client, the requesting host becomes trusted.
+// The client becomes the driver if the requesting host was the driver
+func TransferHost(w http.ResponseWriter, r *http.Request) {
+	host := getHost(w, r)
+	if host == nil {
+		return
+	}
+	target := roleTarget(w, r, host)
+	if target == nil {
+		return
+	}
+
+	if err := host.Hub.TransferHost(host, target); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Info().
+		Str("from", host.ID.String()).
+		Str("to", target.ID.String()).
+		Str("rid", host.Hub.B64ID()).
+		Msg("[api] host transferred")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "POST /api/room/cohost?sid="
+// form: uid, host ("true" to grant the host permission, "false" to demote to trusted). requires a host
+func EditCohost(w http.ResponseWriter, r *http.Request) {
+	host := getHost(w, r)
+	if host == nil {
+		return
+	}
+	grant, err := strconv.ParseBool(r.PostFormValue("host"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	target := roleTarget(w, r, host)
+	if target == nil {
+		return
+	}
+
+	if grant {
+		err = host.Hub.Promote(target)
+	} else {
+		err = host.Hub.Demote(target)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Info().
+		Str("uid", target.ID.String()).
+		Str("by", host.ID.String()).
+		Bool("host", grant).
+		Str("rid", host.Hub.B64ID()).
+		Msg("[api] cohost changed")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "POST /api/room/trust?sid="
+// form: uid, trusted ("true" to grant the trusted permission to a guest, "false" to set it back to guest). requires a host
+func EditTrust(w http.ResponseWriter, r *http.Request) {
+	host := getHost(w, r)
+	if host == nil {
+		return
+	}
+	trusted, err := strconv.ParseBool(r.PostFormValue("trusted"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	target := roleTarget(w, r, host)
+	if target == nil {
+		return
+	}
+
+	if err := host.Hub.Trust(target, trusted); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Info().
+		Str("uid", target.ID.String()).
+		Str("by", host.ID.String()).
+		Bool("trusted", trusted).
+		Str("rid", host.Hub.B64ID()).
+		Msg("[api] trust changed")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "POST /api/room/driver?sid="
+// form: uid, the host which plays the audio and advances the player. requires a host
+func EditDriver(w http.ResponseWriter, r *http.Request) {
+	host := getHost(w, r)
+	if host == nil {
+		return
+	}
+	target := roleTarget(w, r, host)
+	if target == nil {
+		return
+	}
+
+	if err := host.Hub.SetDriver(target); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// returns the client of the uid form in the room of the host, the error is written otherwise
+func roleTarget(w http.ResponseWriter, r *http.Request, host *room.Client) *room.Client {
+	uid, err := uuid.Parse(r.PostFormValue("uid"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil
+	}
+	target := hubClient(host.Hub, uid)
+	if target == nil {
+		http.Error(w, "client not found", http.StatusNotFound)
+		return nil
+	}
+	return target
+}
@@ -1,10 +1,14 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"main/internal/auth"
 	"main/internal/room"
+	"main/internal/source"
 	"main/internal/taskq"
+	"main/internal/transcode"
 	"main/internal/ytdlp"
 	"net/http"
 	"strconv"
@@ -41,10 +45,38 @@ func getClient(sid uuid.UUID) *room.Client {
 	room.TokenMapMutex.RUnlock()
 	room.ClientMapMutex.RUnlock()
 
+	// the session token could be expired or revoked after joining
+	if client.Session != nil && !auth.Accounts.Validate(*client.Session) {
+		log.Debug().
+			Str("uid", client.ID.String()).
+			Msg("[api] Failed to find client, session is no longer valid")
+		return nil
+	}
+
+	return client
+}
+
+// returns the client of the sid query if it is a host of the room, the error is written otherwise
+func getHost(w http.ResponseWriter, r *http.Request) *room.Client {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return nil
+	}
+	if !client.Allowed(room.PERMISSION_HOST) {
+		http.Error(w, "", http.StatusForbidden)
+		return nil
+	}
 	return client
 }
 
 // route: "POST /api/enqueue?sid="
+// form: post_url, or search_id from "/api/search"
 func EnqueueURL(w http.ResponseWriter, r *http.Request) {
 	sid, err := decodeQueryID(r, "sid")
 	if err != nil {
@@ -53,6 +85,14 @@ func EnqueueURL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	pURL := strings.TrimSpace(r.PostFormValue("post_url"))
+	if pSearchID := strings.TrimSpace(r.PostFormValue("search_id")); len(pURL) == 0 && len(pSearchID) > 0 {
+		result, ok := lookupSearchResult(pSearchID)
+		if !ok {
+			http.Error(w, "search result not found", http.StatusBadRequest)
+			return
+		}
+		pURL = result.URL
+	}
 	if len(pURL) == 0 {
 		http.Error(w, "", http.StatusBadRequest)
 		return
@@ -73,13 +113,17 @@ func EnqueueURL(w http.ResponseWriter, r *http.Request) {
 		ErrCh: make(chan error),
 		FinCh: make(chan struct{}),
 	}
-	status, taskID := ytdlp.JsonDownloader.Submit(ctx, &req)
+	status, taskID := source.SubmitInfo(ctx, &req)
 
 	// http: mq response
 	switch status {
 	case http.StatusAccepted:
 		w.WriteHeader(http.StatusAccepted)
 		w.Write([]byte(strconv.FormatInt(taskID, 10)))
+	case http.StatusBadRequest:
+		http.Error(w, "unsupported url", http.StatusBadRequest)
+		cancel()
+		return
 	case http.StatusTooManyRequests:
 		w.WriteHeader(http.StatusTooManyRequests)
 		cancel()
@@ -101,82 +145,87 @@ func EnqueueURL(w http.ResponseWriter, r *http.Request) {
 	// and close the http reponse writer
 	go func() {
 		defer cancel()
-		select {
-		case <-ctx.Done():
-			log.Debug().Msg("[api] json response ctx timeout")
-			taskStatusJson := taskq.TaskStatus{
-				Cmd:    taskq.STATUS_CMD_UPDATE,
-				TaskID: taskID,
-				Status: taskq.STATUS_STR_TIMEOUT,
-			}
-			msg := room.DirectMessage[taskq.TaskStatus]{
-				MsgType: room.MSG_EVENT_PLAYLIST,
-				To:      client.ID,
-				Data:    taskStatusJson,
-			}
-			client.Hub.DirectMsg(&msg)
-			return
-		case err := <-req.ErrCh:
-			log.Error().Err(err).
-				Str("reqURL", req.URL).
-				Msg("[api] InfoJson error")
-			taskStatusJson := taskq.TaskStatus{
-				Cmd:    taskq.STATUS_CMD_UPDATE,
-				TaskID: taskID,
-				Status: taskq.STATUS_STR_FAILED,
-			}
-			msg := room.DirectMessage[taskq.TaskStatus]{
-				MsgType: room.MSG_EVENT_PLAYLIST,
-				To:      client.ID,
-				Data:    taskStatusJson,
-			}
-			client.Hub.DirectMsg(&msg)
-			return
-		case <-req.FinCh:
-			// enqueue playlist
-			node := room.MusicInfo{
-				URL:      pURL,
-				InfoJson: req.Response,
-			}
-			if err := client.Hub.Player.Playlist.Enqueue(&node); err != nil {
-				log.Error().Err(err).Msg("[api] Enqueue URL error")
-				return
-			}
-
-			// responds ok to client
-			taskStatusJson := taskq.TaskStatus{
-				Cmd:    taskq.STATUS_CMD_UPDATE,
-				TaskID: taskID,
-				Status: taskq.STATUS_STR_OK,
-			}
-			dmsg := room.DirectMessage[taskq.TaskStatus]{
-				MsgType: room.MSG_EVENT_PLAYLIST,
-				To:      client.ID,
-				Data:    taskStatusJson,
-			}
-			client.Hub.DirectMsg(&dmsg)
+		awaitEnqueue(ctx, client, &req, taskID)
+	}()
+}
 
-			// broadcast json to websocket
-			wsInfoJson := room.WSInfoJson{
-				ID:       node.ID,
-				Cmd:      room.INFOJSON_CMD_ADD,
-				InfoJson: req.Response,
-			}
-			msg := room.BroadcastMessage[room.WSInfoJson]{
-				MsgType:  room.MSG_EVENT_PLAYLIST,
-				UID:      client.ID.String(),
-				Username: client.Name,
-				Data:     wsInfoJson,
-			}
-			client.Hub.BroadcastMsg(&msg)
+// send the status of the task to the client
+func directTaskStatus(client *room.Client, taskID int64, status taskq.TaskStatusStr) {
+	taskStatusJson := taskq.TaskStatus{
+		Cmd:    taskq.STATUS_CMD_UPDATE,
+		TaskID: taskID,
+		Status: status,
+	}
+	msg := room.DirectMessage[taskq.TaskStatus]{
+		MsgType: room.MSG_EVENT_PLAYLIST,
+		To:      client.ID,
+		Data:    taskStatusJson,
+	}
+	client.Hub.DirectMsg(&msg)
+}
 
-			// notify hub
-			client.SignalMPAdd()
+// wait for the submitted metadata request and enqueue the node,
+// the status of the task is sent to the client. Returns true if the node is enqueued
+func awaitEnqueue(ctx context.Context, client *room.Client, req *ytdlp.RequestInfojson, taskID int64) bool {
+	select {
+	case <-ctx.Done():
+		log.Debug().Msg("[api] json response ctx timeout")
+		directTaskStatus(client, taskID, taskq.STATUS_STR_TIMEOUT)
+		return false
+	case err := <-req.ErrCh:
+		log.Error().Err(err).
+			Str("reqURL", req.URL).
+			Msg("[api] InfoJson error")
+		directTaskStatus(client, taskID, taskq.STATUS_STR_FAILED)
+		return false
+	case <-req.FinCh:
+		// enqueue playlist
+		node := room.MusicInfo{
+			URL:          req.URL,
+			InfoJson:     req.Response,
+			QueuedBy:     client.ID.String(),
+			QueuedByName: client.Name,
 		}
-	}()
+		if err := client.Hub.Player.Playlist.Enqueue(&node); err != nil {
+			log.Error().Err(err).Msg("[api] Enqueue URL error")
+			directTaskStatus(client, taskID, taskq.STATUS_STR_FAILED)
+			return false
+		}
+
+		// responds ok to client
+		directTaskStatus(client, taskID, taskq.STATUS_STR_OK)
+
+		broadcastEnqueued(client, &node)
+
+		// notify hub
+		client.SignalMPAdd()
+		return true
+	}
 }
 
-// route: "GET /api/stream?sid="
+// broadcast the enqueued node to the room of the client
+func broadcastEnqueued(client *room.Client, node *room.MusicInfo) {
+	wsInfoJson := room.WSInfoJson{
+		ID:       node.ID,
+		Cmd:      room.INFOJSON_CMD_ADD,
+		InfoJson: node.InfoJson,
+	}
+	msg := room.BroadcastMessage[room.WSInfoJson]{
+		MsgType:  room.MSG_EVENT_PLAYLIST,
+		UID:      client.ID.String(),
+		Username: client.Name,
+		Data:     wsInfoJson,
+	}
+	client.Hub.BroadcastMsg(&msg)
+}
+
+// route: "GET /api/stream?sid=&quality=&track="
+// quality is optional, the rendition is transcoded on the first request and the original audio is served until it is ready.
+// The served quality is set in the "X-Audio-Quality" header.
+// The renditions are different encodings, a byte range of one rendition does not match the others,
+// clients switching the quality mid-track should stream the HLS variants instead.
+// track is optional, the downloaded upcoming node can be streamed ahead of time for gapless playback,
+// the current node is served if it is omitted
 func StreamAudio(w http.ResponseWriter, r *http.Request) {
 	sid, err := decodeQueryID(r, "sid")
 	if err != nil {
@@ -188,21 +237,157 @@ func StreamAudio(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
+	quality := transcode.QUALITY_ORIGINAL
+	if pQuality := r.URL.Query().Get("quality"); len(pQuality) > 0 {
+		q, ok := transcode.ParseQuality(pQuality)
+		if !ok {
+			http.Error(w, "invalid quality", http.StatusBadRequest)
+			return
+		}
+		quality = q
+	}
 	log.Debug().Str("MP status", client.Hub.Player.String()).Str("rid", client.Hub.B64ID()).Msg("[api] stream")
 
+	var node *room.MusicInfo
+	if pTrack := r.URL.Query().Get("track"); len(pTrack) > 0 {
+		trackID, err := strconv.Atoi(pTrack)
+		if err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		node = client.Hub.Player.Node(trackID)
+		if node == nil {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+	} else {
+		client.Hub.Player.NodeWGCnt.Wait()
+		node = client.Hub.Player.Current()
+	}
+	// the media is read once, the player may download the node meanwhile
+	var media room.NodeMedia
+	if node != nil {
+		media = client.Hub.Player.Media(node)
+	}
+
 	// byte serve the audio
-	client.Hub.Player.NodeWGCnt.Wait()
-	reader := client.Hub.Player.AudioReader
-	if reader == nil {
+	if len(media.AudioByte) > 0 {
+		for _, q := range media.Renditions.Qualities() {
+			w.Header().Add("X-Audio-Qualities", string(q))
+		}
+		if client.Hub.Player.Settings().Normalization == room.NORMALIZE_SERVER {
+			ctx, cancel := context.WithTimeout(r.Context(), ytdlp.TIMEOUT_AUDIO)
+			audio, rend, err := media.NormalizedAudio(ctx, quality)
+			cancel()
+			if err == nil {
+				w.Header().Set("Content-Type", rend.ContentType)
+				w.Header().Set("X-Audio-Quality", string(rend.Quality))
+				w.Header().Set("X-Audio-Normalized", "true")
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(audio))
+				return
+			}
+			log.Debug().Err(err).Str("rid", client.Hub.B64ID()).Msg("[api] failed to normalize audio")
+		}
+		if quality != transcode.QUALITY_ORIGINAL {
+			if audio, rend, ok := media.Rendition(quality); ok {
+				w.Header().Set("Content-Type", rend.ContentType)
+				w.Header().Set("X-Audio-Quality", string(rend.Quality))
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(audio))
+				return
+			}
+		}
+	}
+	if len(media.AudioByte) == 0 {
 		log.Warn().
 			Str("rid", client.Hub.B64ID()).
 			Str("client id", client.B64ID()).
-			Msg("MP byte reader is nil")
+			Msg("MP audio is not downloaded")
 		http.Error(w, "", http.StatusNotFound)
 		return
 	}
+	w.Header().Set("X-Audio-Quality", string(transcode.QUALITY_ORIGINAL))
 
-	http.ServeContent(w, r, "", time.Time{}, reader)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(media.AudioByte))
+}
+
+// route: "GET /api/stream/{track}/{file}?sid="
+// route: "GET /api/stream/{track}/{quality}/{file}?sid="
+// segmented streaming, {file} is "master.m3u8" which lists the quality variants, "index.m3u8" or a segment listed in it.
+// The variants share the segment boundaries, the quality can be switched at any segment.
+// {quality} is optional, HLS_DEFAULT_QUALITY is served if omitted.
+// {track} is the ID of the current or an upcoming node which has been downloaded
+func StreamHLS(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	trackID, err := strconv.Atoi(r.PathValue("track"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	quality := transcode.HLS_DEFAULT_QUALITY
+	pQuality := r.PathValue("quality")
+	if len(pQuality) > 0 {
+		q, ok := transcode.ParseQuality(pQuality)
+		if !ok {
+			http.Error(w, "invalid quality", http.StatusBadRequest)
+			return
+		}
+		quality = q
+	}
+	file := r.PathValue("file")
+
+	node := client.Hub.Player.Node(trackID)
+	if node == nil || !transcode.Enabled {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	variants := client.Hub.Player.Media(node).HLS
+	if variants == nil {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	// a track is immutable, segments can be cached by the client
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if file == transcode.HLS_MASTER_PLAYLIST && len(pQuality) == 0 {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Write(variants.Master(r.URL.RawQuery))
+		return
+	}
+	hls, ok := variants.Variant(quality)
+	if !ok {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), ytdlp.TIMEOUT_AUDIO)
+	defer cancel()
+	if err := hls.Wait(ctx); err != nil {
+		log.Debug().Err(err).Int("track", trackID).Str("rid", client.Hub.B64ID()).Msg("[api] hls not available")
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	if file == transcode.HLS_PLAYLIST {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Write(hls.Playlist(r.URL.RawQuery))
+		return
+	}
+	segment, ok := hls.Segment(file)
+	if !ok {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp2t")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(segment))
 }
 
 // route: "GET /api/streampreload?sid="
@@ -219,15 +404,17 @@ func StreamPreload(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debug().Str("MP status", client.Hub.Player.String()).Str("rid", client.Hub.B64ID()).Msg("[api] streampreload")
 
-	// if client is host?
-	if client.Hub.Host.ID != client.ID {
+	// any host can advance the player, the driver reports it normally
+	if !client.Allowed(room.PERMISSION_HOST) {
 		http.Error(w, "", http.StatusForbidden)
 		return
 	}
 	client.SignalMPPreload()
 }
 
-// route: "GET /api/streamend?sid="
+// route: "GET /api/streamend?sid=&skip="
+// skip is optional, set to true if the host skipped the current node.
+// Only the driver reports the end of the node, the other hosts can only skip it
 func StreamEnd(w http.ResponseWriter, r *http.Request) {
 	sid, err := decodeQueryID(r, "sid")
 	if err != nil {
@@ -241,13 +428,14 @@ func StreamEnd(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debug().Str("MP status", client.Hub.Player.String()).Str("rid", client.Hub.B64ID()).Msg("[api] streamend")
 
-	// if client is host?
-	if client.Hub.Host.ID != client.ID {
+	// every host plays the audio, the node would end once per host
+	skipped, _ := strconv.ParseBool(r.URL.Query().Get("skip"))
+	if !client.Allowed(room.PERMISSION_HOST) || (!skipped && !client.Hub.IsDriver(client)) {
 		http.Error(w, "", http.StatusForbidden)
 		return
 	}
 	client.Hub.Player.NodeWGCnt.Add(1)
-	client.SignalMPNext()
+	client.SignalMPNext(skipped)
 }
 
 type QueueAction struct {
@@ -255,7 +443,13 @@ type QueueAction struct {
 	NodeID int
 }
 
+const (
+	QUEUE_CMD_DELETE  = "del"
+	QUEUE_CMD_SHUFFLE = "shuffle"
+)
+
 // route: "POST /api/queue?sid="
+// body: json of QueueAction, "shuffle" requires the trusted permission
 func EditQueue(w http.ResponseWriter, r *http.Request) {
 	sid, err := decodeQueryID(r, "sid")
 	if err != nil {
@@ -277,6 +471,18 @@ func EditQueue(w http.ResponseWriter, r *http.Request) {
 
 	// slog.Debug("[api] /api/queue", "queueAction", queueAction)
 
+	if queueAction.Cmd == QUEUE_CMD_SHUFFLE {
+		if !client.Allowed(room.PERMISSION_TRUSTED) {
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+		if err := client.Hub.Player.Shuffle(client.ID.String(), client.Name); err != nil {
+			log.Error().Err(err).Msg("[api] shuffle error")
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+
 	err = client.Hub.Player.Playlist.Remove(queueAction.NodeID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"main/internal/auth"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// only the local paths are allowed as the redirect after login
+func localRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/home"
+	}
+	return path
+}
+
+// route: "GET /api/oidc/login?redirect="
+// redirect is optional, the local path to return to after the login, default to "/home"
+func HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if auth.OIDC == nil {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), auth.OIDC_HTTP_TIMEOUT)
+	defer cancel()
+	authURL, state, err := auth.OIDC.AuthURL(ctx, localRedirect(r.URL.Query().Get("redirect")))
+	if err != nil {
+		log.Error().Err(err).Msg("[api] oidc login error")
+		http.Error(w, "", http.StatusBadGateway)
+		return
+	}
+
+	auth.SetOIDCStateCookie(w, r, state)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// route: "GET /api/oidc/callback?code=&state="
+// the redirect_uri registered to the IdP, the session cookie is set like "/api/account/login".
+// The state has to match the state cookie set by "/api/oidc/login" in the same browser
+func HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if auth.OIDC == nil {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	// the state is single use, the cookie is cleared whatever the outcome
+	stateOK := auth.VerifyOIDCStateCookie(r, query.Get("state"))
+	auth.ClearOIDCStateCookie(w, r)
+	if idpErr := query.Get("error"); idpErr != "" {
+		log.Info().Str("error", idpErr).Str("description", query.Get("error_description")).Msg("[api] oidc login denied")
+		http.Error(w, idpErr, http.StatusUnauthorized)
+		return
+	}
+
+	if !stateOK {
+		http.Error(w, auth.ErrOIDCState.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), auth.OIDC_HTTP_TIMEOUT)
+	defer cancel()
+	claims, redirect, err := auth.OIDC.Exchange(ctx, query.Get("state"), query.Get("code"))
+	if errors.Is(err, auth.ErrOIDCState) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("[api] oidc callback error")
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	account, err := auth.Accounts.LoginOIDC(auth.OIDC.Issuer(), claims)
+	if err != nil {
+		log.Error().Err(err).Msg("[api] oidc account error")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("uid", account.UID.String()).Msg("[api] oidc login")
+
+	auth.SetSessionCookie(w, r, account.UID)
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"main/internal/room"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// route: "GET /api/player/settings?sid="
+func PlayerSettings(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	settingsJson, err := json.Marshal(client.Hub.Player.Settings())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode player settings json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(settingsJson)
+}
+
+// route: "POST /api/player/settings?sid="
+// body: json of room.PlayerSettings, omitted fields are unchanged
+func EditPlayerSettings(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	// if client is host?
+	if !client.Allowed(room.PERMISSION_HOST) {
+		http.Error(w, "", http.StatusForbidden)
+		return
+	}
+
+	settings := client.Hub.Player.Settings()
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := client.Hub.Player.SetSettings(settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// websocket: json response
+	msg := room.BroadcastMessage[room.PlayerSettings]{
+		MsgType:  room.MSG_EVENT_PLAYER,
+		UID:      client.ID.String(),
+		Username: client.Name,
+		Data:     settings,
+	}
+	client.Hub.BroadcastMsg(&msg)
+}
+
+// route: "POST /api/player/repeat?sid="
+// form: mode, one of "OFF", "ONE" and "ALL", requires the trusted permission
+func EditRepeatMode(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if !client.Allowed(room.PERMISSION_TRUSTED) {
+		http.Error(w, "", http.StatusForbidden)
+		return
+	}
+
+	mode := room.RepeatMode(r.PostFormValue("mode"))
+	settings, err := client.Hub.Player.SetRepeat(mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// websocket: json response
+	msg := room.BroadcastMessage[room.PlayerSettings]{
+		MsgType:  room.MSG_EVENT_PLAYER,
+		UID:      client.ID.String(),
+		Username: client.Name,
+		Data:     settings,
+	}
+	client.Hub.BroadcastMsg(&msg)
+}
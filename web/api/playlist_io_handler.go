@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"main/internal/playlistio"
+	"main/internal/room"
+	"main/internal/source"
+	"main/internal/taskq"
+	"main/internal/ytdlp"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// upper bound of the imported playlist file
+	IMPORT_MAX_SIZE = 1 << 20
+	// retry interval of an import item when the task queue is full
+	IMPORT_RETRY_INTERVAL = 500 * time.Millisecond
+)
+
+type ImportItemStatus string
+
+const (
+	IMPORT_ITEM_ACCEPTED    ImportItemStatus = "ACCEPTED"
+	IMPORT_ITEM_UNSUPPORTED ImportItemStatus = "UNSUPPORTED"
+)
+
+// http response of an import item, the accepted items are updated by the task status via websocket
+type importItemJson struct {
+	Index  int
+	URL    string
+	TaskID int64 `json:",omitempty"`
+	Status ImportItemStatus
+}
+
+// the played, current and queued nodes of the room
+func exportItems(hub *room.Hub) []playlistio.Item {
+	items := []playlistio.Item{}
+	for _, entry := range hub.History.List() {
+		item := playlistio.Item{
+			URL:      entry.URL,
+			Title:    entry.FullTitle,
+			Uploader: entry.Uploader,
+			Duration: entry.Duration,
+			Status:   playlistio.ITEM_PLAYED,
+		}
+		items = append(items, item)
+	}
+
+	nodeItem := func(node *room.MusicInfo, status playlistio.ItemStatus) playlistio.Item {
+		return playlistio.Item{
+			URL:      node.URL,
+			Title:    node.FullTitle,
+			Uploader: node.Uploader,
+			Duration: node.Duration,
+			Status:   status,
+		}
+	}
+	if cur := hub.Player.Current(); cur != nil {
+		items = append(items, nodeItem(cur, playlistio.ITEM_PLAYING))
+	}
+	for _, id := range hub.Player.Playlist.Order() {
+		if node := hub.Player.Playlist.Find(id); node != nil {
+			items = append(items, nodeItem(node, playlistio.ITEM_QUEUED))
+		}
+	}
+
+	return items
+}
+
+// route: "GET /api/playlist/export?sid=&format="
+// format is one of "json", "m3u" and "txt", default to json
+func ExportPlaylist(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	format := playlistio.FORMAT_JSON
+	if f := r.URL.Query().Get("format"); f != "" {
+		var ok bool
+		if format, ok = playlistio.ParseFormat(f); !ok {
+			http.Error(w, "unknown format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := playlistio.Encode(&buf, format, exportItems(client.Hub)); err != nil {
+		log.Error().Err(err).Msg("Failed to encode exported playlist")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("jukebox-%v%v", time.Now().Format("20060102-150405"), format.Extension())
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(buf.Bytes())
+}
+
+// route: "POST /api/playlist/import?sid=&format="
+// body: the playlist file, format is detected from the content if it is omitted.
+// The supported items are resolved and enqueued in order in the background,
+// the response lists the task ID of each item, the result is sent with websocket as the task status
+func ImportPlaylist(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, IMPORT_MAX_SIZE))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	format := playlistio.Detect(data)
+	if f := r.URL.Query().Get("format"); f != "" {
+		var ok bool
+		if format, ok = playlistio.ParseFormat(f); !ok {
+			http.Error(w, "unknown format", http.StatusBadRequest)
+			return
+		}
+	}
+	items, err := playlistio.Decode(data, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, accepted := importItems(client, items)
+	respJson, err := json.Marshal(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode import status json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(respJson)
+
+	go importAccepted(client, accepted)
+}
+
+// check the items and assign the task IDs, returns the http response and the accepted items
+func importItems(client *room.Client, items []playlistio.Item) ([]importItemJson, []importItemJson) {
+	resp := make([]importItemJson, 0, len(items))
+	accepted := []importItemJson{}
+	for i, item := range items {
+		itemJson := importItemJson{
+			Index: i,
+			URL:   strings.TrimSpace(item.URL),
+		}
+		if _, err := source.Lookup(itemJson.URL); err != nil {
+			itemJson.Status = IMPORT_ITEM_UNSUPPORTED
+		} else {
+			itemJson.TaskID = ytdlp.JsonDownloader.NewTaskID()
+			itemJson.Status = IMPORT_ITEM_ACCEPTED
+			accepted = append(accepted, itemJson)
+		}
+		resp = append(resp, itemJson)
+	}
+	log.Debug().
+		Str("uid", client.ID.String()).
+		Int("items", len(items)).
+		Int("accepted", len(accepted)).
+		Msg("[api] playlist import")
+
+	return resp, accepted
+}
+
+// the items are enqueued one by one to keep the order
+func importAccepted(client *room.Client, accepted []importItemJson) {
+	for _, item := range accepted {
+		importItem(client, item)
+	}
+}
+
+// resolve and enqueue an import item, it waits for the task queue if it is full
+func importItem(client *room.Client, item importItemJson) {
+	ctx, cancel := context.WithTimeout(client.Hub.Context(), ytdlp.TIMEOUT_JSON)
+	defer cancel()
+	req := ytdlp.RequestInfojson{
+		Ctx:   ctx,
+		URL:   item.URL,
+		ErrCh: make(chan error),
+		FinCh: make(chan struct{}),
+	}
+	for {
+		status, _ := source.SubmitInfo(ctx, &req)
+		if status == http.StatusAccepted {
+			break
+		}
+		if status != http.StatusTooManyRequests {
+			directTaskStatus(client, item.TaskID, taskq.STATUS_STR_FAILED)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			directTaskStatus(client, item.TaskID, taskq.STATUS_STR_TIMEOUT)
+			return
+		case <-time.After(IMPORT_RETRY_INTERVAL):
+		}
+	}
+
+	awaitEnqueue(ctx, client, &req, item.TaskID)
+}
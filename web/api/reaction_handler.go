@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"main/internal/room"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// route: "GET /api/reactions?sid="
+// the reaction counts of the current node and the emoji to react with
+func Reactions(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	resp := struct {
+		Emoji   []string
+		Current *room.ReactionEvent `json:",omitempty"`
+	}{
+		Emoji: room.REACTION_EMOJI,
+	}
+	if cur := client.Hub.Player.Current(); cur != nil {
+		event := client.Hub.Reactions.Get(cur.ID)
+		resp.Current = &event
+	}
+	reactionsJson, err := json.Marshal(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode reactions json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(reactionsJson)
+}
+
+// route: "POST /api/reactions?sid="
+// form: emoji, node (optional), the reaction is refused if the node is not playing anymore
+func React(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	nodeID := room.REACTION_ANY_NODE
+	if pNode := r.PostFormValue("node"); len(pNode) > 0 {
+		nodeID, err = strconv.Atoi(pNode)
+		if err != nil || nodeID < 0 {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = client.Hub.React(client, nodeID, r.PostFormValue("emoji"))
+	switch {
+	case err == nil:
+	case errors.Is(err, room.ErrReactionRateLimited):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case errors.Is(err, room.ErrReactionNotPlaying):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "GET /api/history/favorites?sid="
+// the played nodes with reactions, from the most reacted
+func Favorites(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	favoritesJson, err := json.Marshal(client.Hub.History.Favorites())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode favorites json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(favoritesJson)
+}
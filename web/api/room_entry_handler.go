@@ -4,8 +4,12 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"main/internal/auth"
 	"main/internal/room"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
 	"strings"
 	"time"
 
@@ -23,13 +27,40 @@ var (
 
 	// uid -> *sid
 	entryToken = make(map[uuid.UUID]*uuid.UUID)
+
+	// the peers which forward the remote address in X-Real-IP, e.g. the nginx proxy, loopback by default
+	TRUSTED_PROXIES = func() []netip.Prefix {
+		envar := os.Getenv("TRUSTED_PROXIES")
+		if envar == "" {
+			return []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+		}
+		proxies := []netip.Prefix{}
+		for _, s := range strings.Split(envar, ",") {
+			s = strings.TrimSpace(s)
+			prefix, err := netip.ParsePrefix(s)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(s)
+				if addrErr != nil {
+					log.Error().Err(err).Msg("Invalid env: TRUSTED_PROXIES")
+					continue
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			proxies = append(proxies, prefix.Masked())
+		}
+		return proxies
+	}()
 )
 
 type UserProfile struct {
-	name string
-	uid  uuid.UUID
-	rid  uuid.UUID
-	sid  uuid.UUID
+	name       string
+	uid        uuid.UUID
+	rid        uuid.UUID
+	sid        uuid.UUID
+	verified   bool // the uid is bound to the user cookie or the account
+	session    *auth.Session
+	permission int
+	admitted   bool // joins without the approval of the host
 }
 
 func (userProfile *UserProfile) timeout() {
@@ -55,6 +86,29 @@ func decodeQueryID(r *http.Request, key string) (uuid.UUID, error) {
 	return id, nil
 }
 
+// the host of the remote address without the port,
+// it is read from the X-Real-IP header if the request is forwarded by a trusted proxy
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	for _, proxy := range TRUSTED_PROXIES {
+		if !proxy.Contains(peer.Unmap()) {
+			continue
+		}
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap().String()
+		}
+		break
+	}
+	return host
+}
+
 /*
 	Pages
 */
@@ -69,18 +123,44 @@ func HandleDefault(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "app/dist/index.html")
 }
 
-// route: "GET /join?rid="
+// returns the claims of an invite token which is issued for the hub
+func hubInvite(hub *room.Hub, token string) (auth.Invite, error) {
+	claims, err := auth.ParseInviteToken(token)
+	if err != nil {
+		return auth.Invite{}, err
+	}
+	if claims.RID != hub.ID {
+		return auth.Invite{}, auth.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// route: "GET /join?rid=&invite="
+// invite is required if the room is restricted to invited clients
 func HandleJoin(w http.ResponseWriter, r *http.Request) {
 	rid, err := decodeQueryID(r, "rid")
 	if err != nil {
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
-	if _, ok := room.HubMap[rid]; !ok {
+	hub, ok := room.HubMap[rid]
+	if !ok {
 		log.Info().Str("rid", rid.String()).Msg("Hub not found")
 		http.Error(w, "", http.StatusForbidden)
 		return
 	}
+	token := r.URL.Query().Get("invite")
+	if token != "" || hub.Invites.Required() {
+		claims, err := hubInvite(hub, token)
+		if err == nil {
+			_, err = hub.Invites.Check(claims)
+		}
+		if err != nil {
+			log.Info().Err(err).Str("rid", rid.String()).Msg("Invalid invite")
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+	}
 
 	// tmpl := template.Must(template.ParseFiles("app/dist/index.html"))
 	// tmpl.Execute(w, nil)
@@ -92,30 +172,58 @@ func HandleJoin(w http.ResponseWriter, r *http.Request) {
 */
 
 // route: "GET /api/new-user"
+// the uid is bound to the browser by the signed user cookie,
+// which is required to own data outliving the session, e.g. saved playlists
 func HandleNewUser(w http.ResponseWriter, r *http.Request) {
-	userID := uuid.New().String()
-	w.Write([]byte(userID))
+	uid := uuid.New()
+	auth.SetUserCookie(w, r, uid)
+	w.Write([]byte(uid.String()))
 }
 
 // route: "POST /api/session"
+// A logged in user is identified by the session token (cookie or bearer), user_id is ignored.
+// Otherwise user_id is required, which can not be the uid of an account.
+// form: invite, the invite token of room_id, it is used up by the session
+// form: room_password, required by password protected rooms unless invited,
+// the attempts are rate limited per room and per remote address
 func HandleNewSession(w http.ResponseWriter, r *http.Request) {
-	room.ClientMapMutex.RLock()
-	defer room.ClientMapMutex.RUnlock()
 	// return a session id
 	pUsername := r.PostFormValue("cfg_username")
 	pUID := r.PostFormValue("user_id")
+	var name string = strings.TrimSpace(pUsername)
 
-	// never trust the client
-	uid, err := uuid.Parse(pUID)
-	if err != nil {
-		log.Debug().
-			Err(err).
-			Str("uid", pUID).
-			Msg("Invalid user UUID from client")
-		http.Error(w, "", http.StatusBadRequest)
-		return
+	var uid uuid.UUID
+	session, loggedIn := auth.SessionFromRequest(r)
+	if loggedIn {
+		uid = session.UID
+		if account, ok := auth.Accounts.Get(uid); ok && name == "" {
+			name = account.Name
+		}
+	} else {
+		if auth.AUTH_REQUIRED {
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+
+		// never trust the client
+		_uid, err := uuid.Parse(pUID)
+		if err != nil {
+			log.Debug().
+				Err(err).
+				Str("uid", pUID).
+				Msg("Invalid user UUID from client")
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		uid = _uid
+		if auth.Accounts.Exists(uid) {
+			log.Warn().
+				Str("uid", uid.String()).
+				Msg("Session of an account without the session token")
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
 	}
-	var name string = strings.TrimSpace(pUsername)
 
 	var rid uuid.UUID
 	pRID := r.PostFormValue("room_id")
@@ -133,6 +241,29 @@ func HandleNewSession(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// the password hash is slow on purpose, it is verified before the global lock is taken
+	room.ClientMapMutex.RLock()
+	passwordHub := room.HubMap[rid]
+	room.ClientMapMutex.RUnlock()
+	passwordOK := false
+	if passwordHub != nil && passwordHub.Access.Policy == room.ACCESS_PASSWORD &&
+		r.PostFormValue("invite") == "" && !passwordHub.Invites.Required() {
+		addr := remoteHost(r)
+		if !passwordHub.Access.AllowPassword(addr) {
+			log.Info().
+				Str("uid", uid.String()).
+				Str("rid", rid.String()).
+				Str("addr", addr).
+				Msg("Too many room password attempts")
+			http.Error(w, room.ErrPasswordRateLimited.Error(), http.StatusTooManyRequests)
+			return
+		}
+		passwordOK = passwordHub.Access.VerifyPassword(r.PostFormValue("room_password"))
+	}
+
+	room.ClientMapMutex.RLock()
+	defer room.ClientMapMutex.RUnlock()
+
 	// valid data
 	// check user holds a sid already
 	if sid, ok := entryToken[uid]; ok {
@@ -154,13 +285,75 @@ func HandleNewSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the clients join as guests, the invite grants the permission to the client and bypasses the access policy.
+	// The first client of a new room becomes the host when it is registered
+	permission := room.PERMISSION_GUEST
+	admitted := false
+	cookieUID, ok := auth.UserFromCookie(r)
+	verified := loggedIn || (ok && cookieUID == uid)
+	if hub, ok := room.HubMap[rid]; ok {
+		if hub.Bans.Banned(uid) {
+			log.Info().
+				Str("uid", uid.String()).
+				Str("rid", rid.String()).
+				Msg("Banned user")
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+		// a uid chosen by the client could be renewed to bypass the ban
+		if !verified && !hub.Bans.Empty() {
+			log.Info().
+				Str("uid", uid.String()).
+				Str("rid", rid.String()).
+				Msg("Unverified user in a room with bans")
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+		token := r.PostFormValue("invite")
+		if token != "" || hub.Invites.Required() {
+			claims, err := hubInvite(hub, token)
+			if err != nil {
+				http.Error(w, "", http.StatusForbidden)
+				return
+			}
+			invite, err := hub.Invites.Use(claims)
+			if err != nil {
+				log.Info().
+					Err(err).
+					Str("uid", uid.String()).
+					Str("invite", claims.ID.String()).
+					Msg("Failed to use invite")
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if invite.Permission != 0 {
+				permission = invite.Permission
+			}
+			admitted = true
+		}
+		if !admitted && hub.Access.Policy == room.ACCESS_PASSWORD && (hub != passwordHub || !passwordOK) {
+			log.Info().
+				Str("uid", uid.String()).
+				Str("rid", rid.String()).
+				Msg("Wrong room password")
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+	}
+
 	// cache the user profile
 	sid := uuid.New()
 	profile := &UserProfile{
-		name: name,
-		uid:  uid,
-		sid:  sid,
-		rid:  rid,
+		name:       name,
+		uid:        uid,
+		sid:        sid,
+		rid:        rid,
+		verified:   verified,
+		permission: permission,
+		admitted:   admitted,
+	}
+	if loggedIn {
+		profile.session = &session
 	}
 	entryProfiles[sid] = profile
 	entryToken[uid] = &sid
@@ -170,13 +363,20 @@ func HandleNewSession(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(base64SID))
 }
 
-// route: "GET /api/create?sid="
+// route: "GET /api/create?sid=&invite_only=&access="
+// route: "POST /api/create?sid=", form: invite_only, access, password
+// access is one of "open" (default), "password" and "approval", the password is only read from the body
 func HandleCreateRoom(w http.ResponseWriter, r *http.Request) {
 	sid, err := decodeQueryID(r, "sid")
 	if err != nil {
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
+	policy, ok := room.ParseAccessPolicy(r.FormValue("access"))
+	if !ok {
+		http.Error(w, "Invalid access policy", http.StatusBadRequest)
+		return
+	}
 
 	// valid data
 	userProfile, ok := entryProfiles[sid]
@@ -195,10 +395,18 @@ func HandleCreateRoom(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "", http.StatusTooManyRequests)
 		return
 	}
+	access, err := room.NewAccess(policy, r.PostFormValue("password"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	rid := uuid.New()
 	userProfile.rid = rid
+	userProfile.admitted = true
 
 	hub := room.CreateHub(rid)
+	hub.Access = access
+	hub.Invites.SetRequired(r.FormValue("invite_only") == "true")
 	room.HubMap[rid] = hub
 	room.NewHubs[sid] = hub
 	// reclaim memory when anything goes wrong
@@ -210,8 +418,23 @@ func HandleCreateRoom(w http.ResponseWriter, r *http.Request) {
 }
 
 type userJson struct {
-	Name string `json:"name"`
-	Host bool   `json:"host"`
+	Name   string `json:"name"`
+	Host   bool   `json:"host"`
+	Driver bool   `json:"driver"` // plays the audio of the room
+}
+
+// the roles are changed with ClientMapMutex held, it should be read locked by the caller
+func hubUserList(hub *room.Hub) map[string]userJson {
+	userlist := make(map[string]userJson)
+	for c, permission := range hub.Clients {
+		userjson := userJson{
+			Name:   c.Name,
+			Host:   permission == room.PERMISSION_HOST,
+			Driver: c == hub.Driver,
+		}
+		userlist[c.ID.String()] = userjson
+	}
+	return userlist
 }
 
 // route: "GET /api/users?sid="
@@ -249,20 +472,7 @@ func UserList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userlist := make(map[string]userJson)
-	for c := range client.Hub.Clients {
-		isHost := false
-		if c.ID == c.Hub.Host.ID {
-			isHost = true
-		}
-		userjson := userJson{
-			Name: c.Name,
-			Host: isHost,
-		}
-		userlist[c.ID.String()] = userjson
-	}
-
-	json, err := json.Marshal(userlist)
+	json, err := json.Marshal(hubUserList(client.Hub))
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to encode userlist json")
 		http.Error(w, "", http.StatusInternalServerError)
@@ -316,3 +526,44 @@ func Playlist(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(jsonList)
 }
+
+// the state of a room, for clients to catch up in a single request
+type roomSnapshot struct {
+	Users    map[string]userJson `json:"users"`
+	Playlist []room.MusicInfo    `json:"playlist"`
+	History  []room.HistoryEntry `json:"history"`
+	Settings room.PlayerSettings `json:"settings"`
+}
+
+// route: "GET /api/room?sid="
+func RoomSnapshot(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	hub := client.Hub
+	room.ClientMapMutex.RLock()
+	users := hubUserList(hub)
+	room.ClientMapMutex.RUnlock()
+	snapshot := roomSnapshot{
+		Users:    users,
+		Playlist: hub.Player.MusicInfoList(),
+		History:  hub.History.List(),
+		Settings: hub.Player.Settings(),
+	}
+	snapshotJson, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode room snapshot json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(snapshotJson)
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"main/internal/playlistio"
+	"main/internal/playlists"
+	"main/internal/room"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// body of creating and updating a saved playlist
+type savedPlaylistJson struct {
+	Name  *string
+	Items []playlistio.Item
+	// save the history, current and queued nodes of the room instead of Items
+	FromRoom bool
+}
+
+// returns the uid of the session if it is bound to the user cookie,
+// the session is either connected to a room or waiting to join
+func sessionUser(sid uuid.UUID) (uuid.UUID, bool) {
+	if client := getClient(sid); client != nil {
+		return client.ID, client.Verified
+	}
+	// entryProfiles is written by the entry handlers with ClientMapMutex held
+	room.ClientMapMutex.RLock()
+	defer room.ClientMapMutex.RUnlock()
+	if profile, ok := entryProfiles[sid]; ok {
+		return profile.uid, profile.verified
+	}
+	return uuid.Nil, false
+}
+
+// decode the sid and returns the verified uid, the error response is written if it fails
+func requireUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	uid, ok := sessionUser(sid)
+	if !ok {
+		http.Error(w, "user is not verified", http.StatusUnauthorized)
+		return uuid.Nil, false
+	}
+	return uid, true
+}
+
+func playlistError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, playlists.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, playlists.ErrNameTaken), errors.Is(err, playlists.ErrTooMany):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, playlists.ErrName), errors.Is(err, playlistio.ErrTooManyItems):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Error().Err(err).Msg("[api] saved playlist error")
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func writePlaylistJson(w http.ResponseWriter, v any) {
+	respJson, err := json.Marshal(v)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode saved playlist json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Write(respJson)
+}
+
+// route: "GET /api/playlists?sid="
+func ListSavedPlaylists(w http.ResponseWriter, r *http.Request) {
+	uid, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	writePlaylistJson(w, playlists.Default.List(uid))
+}
+
+// route: "POST /api/playlists?sid="
+// body: json of savedPlaylistJson, FromRoom requires the session to be in a room
+func CreateSavedPlaylist(w http.ResponseWriter, r *http.Request) {
+	uid, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body savedPlaylistJson
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, IMPORT_MAX_SIZE)).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.Name == nil {
+		http.Error(w, playlists.ErrName.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.FromRoom {
+		sid, _ := decodeQueryID(r, "sid")
+		client := getClient(sid)
+		if client == nil {
+			http.Error(w, "not in a room", http.StatusBadRequest)
+			return
+		}
+		body.Items = exportItems(client.Hub)
+	}
+
+	playlist, err := playlists.Default.Create(uid, *body.Name, body.Items)
+	if err != nil {
+		playlistError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writePlaylistJson(w, playlist)
+}
+
+// route: "GET /api/playlists/{id}?sid="
+func GetSavedPlaylist(w http.ResponseWriter, r *http.Request) {
+	uid, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	playlist, err := playlists.Default.Get(uid, r.PathValue("id"))
+	if err != nil {
+		playlistError(w, err)
+		return
+	}
+	writePlaylistJson(w, playlist)
+}
+
+// route: "PUT /api/playlists/{id}?sid="
+// body: json of savedPlaylistJson, omitted fields are unchanged
+func UpdateSavedPlaylist(w http.ResponseWriter, r *http.Request) {
+	uid, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body savedPlaylistJson
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, IMPORT_MAX_SIZE)).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	playlist, err := playlists.Default.Update(uid, r.PathValue("id"), body.Name, body.Items)
+	if err != nil {
+		playlistError(w, err)
+		return
+	}
+	writePlaylistJson(w, playlist)
+}
+
+// route: "DELETE /api/playlists/{id}?sid="
+func DeleteSavedPlaylist(w http.ResponseWriter, r *http.Request) {
+	uid, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := playlists.Default.Delete(uid, r.PathValue("id")); err != nil {
+		playlistError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// route: "POST /api/playlists/{id}/load?sid="
+// the items are enqueued to the room of the session like "/api/playlist/import"
+func LoadSavedPlaylist(w http.ResponseWriter, r *http.Request) {
+	uid, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	sid, _ := decodeQueryID(r, "sid")
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "not in a room", http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := playlists.Default.Get(uid, r.PathValue("id"))
+	if err != nil {
+		playlistError(w, err)
+		return
+	}
+
+	resp, accepted := importItems(client, playlist.Items)
+	respJson, err := json.Marshal(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode import status json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(respJson)
+
+	go importAccepted(client, accepted)
+}
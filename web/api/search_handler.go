@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"main/internal/ytdlp"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// search results can be enqueued by ID within this duration
+	TIMEOUT_SEARCH_RESULT = 10 * time.Minute
+
+	SEARCH_DEFAULT_RESULTS = 5
+	SEARCH_MAX_QUERY_LEN   = 200
+)
+
+type searchEntry struct {
+	result ytdlp.SearchResult
+	expire time.Time
+}
+
+var (
+	// search result id -> search result
+	searchResults      = make(map[string]*searchEntry)
+	searchResultsMutex = sync.RWMutex{}
+)
+
+func cacheSearchResult(result ytdlp.SearchResult) {
+	searchResultsMutex.Lock()
+	defer searchResultsMutex.Unlock()
+
+	searchResults[result.ID] = &searchEntry{
+		result: result,
+		expire: time.Now().Add(TIMEOUT_SEARCH_RESULT),
+	}
+	time.AfterFunc(TIMEOUT_SEARCH_RESULT, func() {
+		searchResultsMutex.Lock()
+		defer searchResultsMutex.Unlock()
+		// the entry could be refreshed by a later search
+		if entry, ok := searchResults[result.ID]; ok && time.Now().After(entry.expire) {
+			delete(searchResults, result.ID)
+		}
+	})
+}
+
+func lookupSearchResult(id string) (ytdlp.SearchResult, bool) {
+	searchResultsMutex.RLock()
+	defer searchResultsMutex.RUnlock()
+
+	entry, ok := searchResults[id]
+	if !ok {
+		return ytdlp.SearchResult{}, false
+	}
+	return entry.result, true
+}
+
+// route: "GET /api/search?sid=&q=&n="
+// the ID of the results can be posted to "/api/enqueue" as search_id
+func Search(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len(query) == 0 || len(query) > SEARCH_MAX_QUERY_LEN {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	limit := SEARCH_DEFAULT_RESULTS
+	if n, err := strconv.Atoi(r.URL.Query().Get("n")); err == nil {
+		limit = max(1, min(n, ytdlp.SEARCH_MAX_RESULTS))
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ytdlp.TIMEOUT_SEARCH)
+	defer cancel()
+	req := ytdlp.RequestSearch{
+		Ctx:   ctx,
+		Query: query,
+		Limit: limit,
+		ErrCh: make(chan error),
+		FinCh: make(chan struct{}),
+	}
+	status, _ := ytdlp.JsonDownloader.Submit(ctx, &req)
+	if status != http.StatusAccepted {
+		w.WriteHeader(status)
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		log.Debug().Str("query", query).Msg("[api] search ctx timeout")
+		http.Error(w, "", http.StatusGatewayTimeout)
+		return
+	case err := <-req.ErrCh:
+		log.Error().Err(err).Str("query", query).Msg("[api] search error")
+		http.Error(w, "", http.StatusBadGateway)
+		return
+	case <-req.FinCh:
+	}
+
+	for _, result := range req.Response {
+		cacheSearchResult(result)
+	}
+	jsonList, err := json.Marshal(req.Response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode search result json")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(jsonList)
+}
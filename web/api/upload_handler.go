@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"main/internal/room"
+	"main/internal/upload"
+	"main/internal/ytdlp"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// route: "POST /api/upload?sid="
+// multipart form with the audio file in the "file" field
+func UploadAudio(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	// leave some room for the multipart headers
+	r.Body = http.MaxBytesReader(w, r.Body, upload.MAX_UPLOAD_SIZE+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	// stream the first file part to disk
+	var file upload.File
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			http.Error(w, "file not found", http.StatusBadRequest)
+			return
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		file, err = upload.Default.Save(part, part.FileName(), client.Hub.ID)
+		part.Close()
+		switch {
+		case err == nil:
+		case errors.Is(err, upload.ErrTooLarge), errors.As(err, &maxBytesErr):
+			http.Error(w, "", http.StatusRequestEntityTooLarge)
+			return
+		case errors.Is(err, upload.ErrUnsupported):
+			http.Error(w, "", http.StatusUnsupportedMediaType)
+			return
+		default:
+			log.Error().Err(err).Str("uid", client.ID.String()).Msg("[api] failed to save uploaded file")
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+
+	uploader := file.Tags.Artist
+	if uploader == "" {
+		uploader = client.Name
+	}
+	node := room.MusicInfo{
+		URL: file.Ref(),
+		InfoJson: ytdlp.InfoJson{
+			FullTitle: file.Tags.Title,
+			Uploader:  uploader,
+			Duration:  file.Tags.Duration,
+		},
+		QueuedBy:     client.ID.String(),
+		QueuedByName: client.Name,
+	}
+	if err := client.Hub.Player.Playlist.Enqueue(&node); err != nil {
+		log.Error().Err(err).Msg("[api] Enqueue upload error")
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Write([]byte(strconv.Itoa(node.ID)))
+
+	// notify the room without blocking the response
+	go func() {
+		broadcastEnqueued(client, &node)
+		client.SignalMPAdd()
+	}()
+}
@@ -1,15 +1,24 @@
 package api
 
 import (
+	"main/internal/auth"
 	"main/internal/room"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog/log"
 )
 
 // route: /ws?sid=
+// route: /ws?sid=&resume=&seq=, see resumeWebSocket()
 func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("resume") {
+		resumeWebSocket(w, r)
+		return
+	}
+
 	room.ClientMapMutex.Lock()
 	room.TokenMapMutex.Lock()
 	defer func() {
@@ -54,6 +63,14 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "", http.StatusInternalServerError)
 		return
 	}
+	if hub.Bans.Banned(profile.uid) {
+		log.Info().
+			Str("uid", profile.uid.String()).
+			Str("rid", hub.B64ID()).
+			Msg("[ws] banned user")
+		http.Error(w, "", http.StatusForbidden)
+		return
+	}
 
 	// switch to websocket
 	conn, err := room.Upgrader.Upgrade(w, r, nil)
@@ -74,12 +91,27 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		ID:            profile.uid,
 		Token:         sid,
 		Name:          profile.name,
-		Permission:    7,
-		Send:          make(chan []byte, 1024),
+		Permission:    profile.permission,
+		Verified:      profile.verified,
+		Session:       profile.session,
+		Send:          make(chan []byte, room.SEND_BUFFER_SIZE),
 		JoinUnixMilli: time.Now().UnixMilli(),
 	}
+	// clean up the API entry cache
+	delete(entryProfiles, sid)
+	delete(entryToken, client.ID)
+
+	if hub.Access.Policy == room.ACCESS_APPROVAL && !profile.admitted {
+		go awaitApproval(client)
+		return
+	}
+	joinHub(client)
+}
+
+// register the client to its hub, ClientMapMutex and TokenMapMutex should be locked by the caller
+func joinHub(client *room.Client) {
 	room.ClientMap[client.ID] = client
-	room.TokenMap[sid] = &client.ID
+	room.TokenMap[client.Token] = &client.ID
 
 	// broadcast join notification
 	msg := room.BroadcastMessage[room.Event]{
@@ -88,13 +120,78 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		Username: client.Name,
 		Data:     "join",
 	}
-	// broadcast before joining, avoid duplicating in client in frontend
-	client.Hub.BroadcastMsg(&msg)
-	client.Hub.Register <- client
-	go client.Read()
-	go client.Write()
+	// the hub loop takes ClientMapMutex, the client is handed over without waiting for the loop
+	go func() {
+		// broadcast before joining, avoid duplicating in client in frontend
+		client.Hub.BroadcastMsg(&msg)
+		client.Hub.Register <- client
+		go client.Read()
+		go client.Write()
+	}()
+}
 
-	// clean up the API entry cache
-	delete(entryProfiles, sid)
-	delete(entryToken, client.ID)
+// the client joins once the host accepts the join request
+func awaitApproval(client *room.Client) {
+	if !client.Hub.AwaitApproval(client) {
+		return
+	}
+
+	room.ClientMapMutex.Lock()
+	room.TokenMapMutex.Lock()
+	defer func() {
+		room.TokenMapMutex.Unlock()
+		room.ClientMapMutex.Unlock()
+	}()
+
+	// the user could have joined with another session while waiting
+	if _, ok := room.ClientMap[client.ID]; ok {
+		log.Debug().
+			Str("uid", client.ID.String()).
+			Msg("[ws] Client has already connected")
+		client.Conn.Close()
+		return
+	}
+	client.JoinUnixMilli = time.Now().UnixMilli()
+	joinHub(client)
+}
+
+// resume the session of a disconnected client within the grace period,
+// resume is the token sent to the client on joining, seq is the number of messages it has received
+func resumeWebSocket(w http.ResponseWriter, r *http.Request) {
+	sid, err := decodeQueryID(r, "sid")
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	seq, err := strconv.ParseUint(r.URL.Query().Get("seq"), 10, 64)
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	client := getClient(sid)
+	if client == nil || !auth.VerifyResumeToken(r.URL.Query().Get("resume"), client.ID, sid) {
+		log.Debug().
+			Str("sid", sid.String()).
+			Msg("[ws] session can not be resumed")
+		http.Error(w, "", http.StatusForbidden)
+		return
+	}
+
+	conn, err := room.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error().
+			Str("sid", sid.String()).
+			Str("uid", client.ID.String()).
+			Err(err).
+			Msg("[ws] websocket upgrade error")
+		return
+	}
+	if err := client.Hub.Resume(client, conn, seq); err != nil {
+		conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()),
+			time.Now().Add(time.Second),
+		)
+		conn.Close()
+	}
 }
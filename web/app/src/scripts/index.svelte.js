@@ -18,6 +18,10 @@ const session = $state({
 	playlist: [],
 	/** @type {Array.<InfoJsonTaskStatus>} */
 	queuelist: [],
+	/** @type {Array.<{ID: number, UID: string, Username: string, Text: string, UnixMilli: number}>} */
+	chat: [],
+	/** @type {{NodeID: number, Counts: Object.<string, number>}} reaction counts of the current node */
+	reactions: { NodeID: -1, Counts: {} },
 	userID: null,
 	hostID: null,
 });
@@ -35,6 +39,8 @@ const API_PATH = Object.freeze({
 	STREAM: "/api/stream",
 	STREAM_END: "/api/streamend",
 	STREAM_PRELOAD: "/api/streampreload",
+	CHAT: "/api/chat",
+	REACTIONS: "/api/reactions",
 	// other
 	JOIN: "/join",
 	WEBSOCKET: "/ws",
@@ -48,6 +54,8 @@ const MSG_TYPE = Object.freeze({
 	EVENT_PEER: 2,
 	EVENT_PLAYLIST: 3,
 	EVENT_PLAYER: 4,
+	EVENT_CHAT: 5,
+	EVENT_REACTION: 6,
 })
 
 const PLAYLIST_CMD = Object.freeze({
@@ -57,6 +65,12 @@ const PLAYLIST_CMD = Object.freeze({
 	SWAP: "SWAP",
 })
 
+const CHAT_CMD = Object.freeze({
+	ADD: "ADD",
+	DELETE: "DELETE",
+	HISTORY: "HISTORY",
+})
+
 const TASK_STATUS_STR = Object.freeze({
 	LOADING: "LOADING",
 	OK: "OK",
@@ -124,6 +138,11 @@ async function fetchSessionIDJoin(form) {
 	const formData = new FormData(form)
 	formData.append("user_id", window.localStorage.getItem("userID"))
 	formData.append("room_id", session.roomID)
+	// the invite token of the join link, required by invite only rooms
+	const invite = new URLSearchParams(window.location.search).get("invite")
+	if (invite) {
+		formData.append("invite", invite)
+	}
 
 	const sid = await fetch(API_PATH.SESSION, {
 		method: "POST",
@@ -254,7 +273,7 @@ async function requestJoinRoom(event, form) {
 	await fetchUserList().then(data => {
 		for (const id in data) {
 			session.userList[id] = data[id]
-			if (data[id].host === true) {
+			if (data[id].driver === true) {
 				session.hostID = id
 			}
 		}
@@ -268,29 +287,66 @@ async function requestJoinRoom(event, form) {
 const ws = $state({
 	/** @type {WebSocket?} ws */
 	client: null,
+	// the number of messages received, the server replays the missed ones on resume
+	seq: 0,
+	resume: null,
+	grace: 0,
 })
 
+// close code of kick, ban and denied join request, the session can not be resumed
+const WS_CLOSE_POLICY = 1008
+
 function connectWebSocket() {
 	const wsPath = "wss://" + document.location.host + API_PATH.WEBSOCKET + "?sid=" + session.sessionID
+	ws.seq = 0
+	return openWebSocket(wsPath)
+}
+
+function resumeWebSocket(deadline) {
+	if (Date.now() > deadline) {
+		console.warn("ws resume expired")
+		return
+	}
+	const wsPath = "wss://" + document.location.host + API_PATH.WEBSOCKET + "?sid=" + session.sessionID
+		+ "&resume=" + encodeURIComponent(ws.resume) + "&seq=" + ws.seq
+	openWebSocket(wsPath).catch(() => {
+		setTimeout(() => resumeWebSocket(deadline), 2000)
+	})
+}
+
+function openWebSocket(wsPath) {
 	return new Promise((resolve, reject) => {
-		ws.client = new WebSocket(wsPath)
+		const client = new WebSocket(wsPath)
+		ws.client = client
+		let opened = false
 
-		ws.client.onopen = (event) => {
+		client.onopen = (event) => {
 			console.log("ws open: " + JSON.stringify(event))
+			opened = true
 			resolve()
 		}
-		ws.client.onerror = (event) => {
+		client.onerror = (event) => {
 			console.log("ws err: " + JSON.stringify(event))
 			reject()
 		}
-		ws.client.onclose = (event) => {
+		client.onclose = (event) => {
 			console.log("ws close: " + JSON.stringify(event))
 			reject()
+			// the connection is lost, resume within the grace period
+			if (opened && ws.client === client && ws.resume && event.code !== WS_CLOSE_POLICY) {
+				resumeWebSocket(Date.now() + ws.grace * 1000)
+			}
 		}
 
-		ws.client.onmessage = (event) => {
+		client.onmessage = (event) => {
 			//console.log("ws recv: " + event.data)
+			ws.seq++
 			const msg = JSON.parse(event.data)
+			if (msg.Data?.Resume) {
+				ws.resume = msg.Data.Resume
+				ws.grace = msg.Data.Grace
+				return
+			}
 			switch (msg.MsgType) {
 				case MSG_TYPE.EVENT_ROOM:
 					updateRoomStatus(msg)
@@ -305,6 +361,12 @@ function connectWebSocket() {
 				case MSG_TYPE.EVENT_PLAYER:
 					updateMP(msg)
 					break
+				case MSG_TYPE.EVENT_CHAT:
+					updateChat(msg)
+					break
+				case MSG_TYPE.EVENT_REACTION:
+					session.reactions = msg.Data
+					break
 				default:
 					break
 			}
@@ -320,13 +382,23 @@ function updateRoomStatus(msg) {
 			session.userList[msg.UID] = { name: msg.Username, host: false }
 			break
 		}
-		case "left": {
+		case "left":
+		case "kick":
+		case "ban": {
 			delete session.userList[msg.UID]
 			break
 		}
 		case "host": {
-			session.hostID = msg.UID
 			session.userList[msg.UID].host = true
+			break
+		}
+		case "demote": {
+			session.userList[msg.UID].host = false
+			break
+		}
+		case "driver": {
+			// hostID is the driver, it plays the audio of the room
+			session.hostID = msg.UID
 			rtcRestart()
 			break
 		}
@@ -336,6 +408,24 @@ function updateRoomStatus(msg) {
 	}
 }
 
+function updateChat(msg) {
+	const cmd = msg.Data.Cmd
+	switch (cmd) {
+		case CHAT_CMD.ADD:
+			session.chat.push(msg.Data.Message)
+			break
+		case CHAT_CMD.DELETE:
+			session.chat = session.chat.filter((entry) => entry.ID != msg.Data.ID)
+			break
+		case CHAT_CMD.HISTORY:
+			session.chat = msg.Data.History
+			break
+		default:
+			console.warn(`[updateChat] got unknown cmd: ${cmd}`)
+			break
+	}
+}
+
 function updatePlaylist(msg) {
 	const cmd = msg.Data.Cmd
 	switch (cmd) {
@@ -382,7 +472,7 @@ function updatePeerConnection(msg) {
 	const evt = msg.Data
 	if (evt === "join") {
 		addPeer(msg)
-	} else if (evt === "left") {
+	} else if (evt === "left" || evt === "kick" || evt === "ban") {
 		removePeer(msg)
 	}
 }
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"main/api"
+	"main/internal/library"
+	"main/internal/upload"
 	"main/internal/ytdlp"
 	"main/utils/gzipped"
 
@@ -33,6 +35,13 @@ func main() {
 	go ytdlp.JsonDownloader.Run(jsonctx)
 	go ytdlp.AudioDownloader.Run(audioctx)
 
+	// local music library
+	if library.Default != nil {
+		go library.Default.Run(dlpctx)
+	}
+	// clean up uploaded files
+	go upload.Default.Run(dlpctx)
+
 	mux := http.NewServeMux()
 
 	appFS := gzipped.GzipFileServer(http.FileServer(http.Dir("app/dist")))
@@ -46,14 +55,60 @@ func main() {
 	// api
 	mux.HandleFunc("GET /api/new-user", api.HandleNewUser)
 	mux.HandleFunc("POST /api/session", api.HandleNewSession)
+	mux.HandleFunc("POST /api/account/register", api.HandleRegister)
+	mux.HandleFunc("POST /api/account/login", api.HandleLogin)
+	mux.HandleFunc("POST /api/account/logout", api.HandleLogout)
+	mux.HandleFunc("GET /api/account", api.HandleAccount)
+	mux.HandleFunc("GET /api/oidc/login", api.HandleOIDCLogin)
+	mux.HandleFunc("GET /api/oidc/callback", api.HandleOIDCCallback)
 	mux.HandleFunc("GET /api/create", api.HandleCreateRoom)
+	mux.HandleFunc("POST /api/create", api.HandleCreateRoom)
 	mux.HandleFunc("GET /api/users", api.UserList)
 	mux.HandleFunc("GET /api/playlist", api.Playlist)
+	mux.HandleFunc("GET /api/playlist/export", api.ExportPlaylist)
+	mux.HandleFunc("POST /api/playlist/import", api.ImportPlaylist)
+	mux.HandleFunc("GET /api/playlists", api.ListSavedPlaylists)
+	mux.HandleFunc("POST /api/playlists", api.CreateSavedPlaylist)
+	mux.HandleFunc("GET /api/playlists/{id}", api.GetSavedPlaylist)
+	mux.HandleFunc("PUT /api/playlists/{id}", api.UpdateSavedPlaylist)
+	mux.HandleFunc("DELETE /api/playlists/{id}", api.DeleteSavedPlaylist)
+	mux.HandleFunc("POST /api/playlists/{id}/load", api.LoadSavedPlaylist)
+	mux.HandleFunc("GET /api/room", api.RoomSnapshot)
+	mux.HandleFunc("GET /api/room/requests", api.JoinRequests)
+	mux.HandleFunc("POST /api/room/requests", api.AnswerJoinRequest)
+	mux.HandleFunc("POST /api/room/kick", api.KickClient)
+	mux.HandleFunc("POST /api/room/ban", api.BanClient)
+	mux.HandleFunc("GET /api/room/bans", api.ListBans)
+	mux.HandleFunc("DELETE /api/room/bans/{uid}", api.Unban)
+	mux.HandleFunc("POST /api/room/host", api.TransferHost)
+	mux.HandleFunc("POST /api/room/cohost", api.EditCohost)
+	mux.HandleFunc("POST /api/room/trust", api.EditTrust)
+	mux.HandleFunc("POST /api/room/driver", api.EditDriver)
+	mux.HandleFunc("GET /api/invites", api.ListInvites)
+	mux.HandleFunc("POST /api/invites", api.CreateInvite)
+	mux.HandleFunc("DELETE /api/invites/{id}", api.RevokeInvite)
+	mux.HandleFunc("POST /api/invites/required", api.EditInviteRequired)
+	mux.HandleFunc("GET /api/history", api.History)
+	mux.HandleFunc("POST /api/history/requeue", api.RequeueHistory)
+	mux.HandleFunc("GET /api/history/favorites", api.Favorites)
+	mux.HandleFunc("GET /api/chat", api.ChatHistory)
+	mux.HandleFunc("POST /api/chat", api.PostChat)
+	mux.HandleFunc("DELETE /api/chat/{id}", api.DeleteChat)
+	mux.HandleFunc("GET /api/reactions", api.Reactions)
+	mux.HandleFunc("POST /api/reactions", api.React)
 	mux.HandleFunc("POST /api/enqueue", api.EnqueueURL)
+	mux.HandleFunc("GET /api/search", api.Search)
 	mux.HandleFunc("POST /api/queue", api.EditQueue)
 	mux.HandleFunc("GET /api/stream", api.StreamAudio)
+	mux.HandleFunc("GET /api/stream/{track}/{file}", api.StreamHLS)
+	mux.HandleFunc("GET /api/stream/{track}/{quality}/{file}", api.StreamHLS)
 	mux.HandleFunc("GET /api/streamend", api.StreamEnd)
 	mux.HandleFunc("GET /api/streampreload", api.StreamPreload)
+	mux.HandleFunc("GET /api/player/settings", api.PlayerSettings)
+	mux.HandleFunc("POST /api/player/settings", api.EditPlayerSettings)
+	mux.HandleFunc("POST /api/player/repeat", api.EditRepeatMode)
+	mux.HandleFunc("GET /api/library/search", api.LibrarySearch)
+	mux.HandleFunc("POST /api/upload", api.UploadAudio)
 
 	// WebSocket
 	mux.HandleFunc("/ws", api.HandleWebSocket)
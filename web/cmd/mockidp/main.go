@@ -0,0 +1,243 @@
+// mockidp is a minimal OpenID Connect provider for testing the OIDC login locally.
+// Every authorization request is approved without a login page,
+// the subject is taken from the "login_hint" parameter, default to "alice".
+// It must not be exposed to the public.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	KEY_ID       = "mockidp"
+	CODE_TTL     = time.Minute
+	ID_TOKEN_TTL = time.Hour
+)
+
+var (
+	ADDR = func() string {
+		if addr := os.Getenv("MOCKIDP_ADDR"); addr != "" {
+			return addr
+		}
+		return ":9000"
+	}()
+	ISSUER = func() string {
+		if issuer := os.Getenv("MOCKIDP_ISSUER"); issuer != "" {
+			return issuer
+		}
+		return "http://localhost:9000"
+	}()
+)
+
+type authCode struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	subject     string
+	expiry      time.Time
+}
+
+type provider struct {
+	key *rsa.PrivateKey
+
+	sync.Mutex
+	codes map[string]*authCode
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]any{
+		"issuer":                                ISSUER,
+		"authorization_endpoint":                ISSUER + "/authorize",
+		"token_endpoint":                        ISSUER + "/token",
+		"jwks_uri":                              ISSUER + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	enc := base64.RawURLEncoding
+	writeJson(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KEY_ID,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   enc.EncodeToString(pub.N.Bytes()),
+			"e":   enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("client_id") == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE S256 is required", http.StatusBadRequest)
+		return
+	}
+	subject := query.Get("login_hint")
+	if subject == "" {
+		subject = "alice"
+	}
+
+	code := randomString(32)
+	p.Lock()
+	p.codes[code] = &authCode{
+		clientID:    query.Get("client_id"),
+		redirectURI: redirectURI.String(),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		subject:     subject,
+		expiry:      time.Now().Add(CODE_TTL),
+	}
+	p.Unlock()
+	log.Info().Str("sub", subject).Str("client_id", query.Get("client_id")).Msg("[mockidp] authorized")
+
+	callback := redirectURI.Query()
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(reason string) {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": reason})
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	p.Lock()
+	code, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.Unlock()
+	clientID := r.PostFormValue("client_id")
+	if basicID, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(basicID)
+	}
+	switch {
+	case !ok || time.Now().After(code.expiry):
+		tokenError("unknown or expired code")
+		return
+	case code.clientID != clientID:
+		tokenError("client_id mismatch")
+		return
+	case code.redirectURI != r.PostFormValue("redirect_uri"):
+		tokenError("redirect_uri mismatch")
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != code.challenge {
+		tokenError("code_verifier mismatch")
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.sign(map[string]any{
+		"iss":                ISSUER,
+		"sub":                code.subject,
+		"aud":                code.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(ID_TOKEN_TTL).Unix(),
+		"nonce":              code.nonce,
+		"name":               code.subject,
+		"preferred_username": code.subject,
+		"email":              code.subject + "@example.com",
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("[mockidp] failed to sign id token")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]any{
+		"access_token": randomString(32),
+		"token_type":   "Bearer",
+		"expires_in":   int(ID_TOKEN_TTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// sign the claims as a RS256 JWT
+func (p *provider) sign(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": KEY_ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
+
+func main() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.DateTime})
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to generate key")
+	}
+	p := &provider{
+		key:   key,
+		codes: make(map[string]*authCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+
+	log.Warn().Str("addr", ADDR).Str("issuer", ISSUER).Msg("mock IdP running, every login is approved")
+	if err := http.ListenAndServe(ADDR, mux); err != nil {
+		log.Fatal().Err(err).Msg("Server panic")
+	}
+}
@@ -1,6 +1,6 @@
 module main
 
-go 1.23.0
+go 1.24.0
 
 require github.com/google/uuid v1.6.0
 
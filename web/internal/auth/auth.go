@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// key of the signed tokens, a random key is generated if it is not set,
+	// the issued tokens are invalidated on restart in that case
+	SECRET_KEY = func() []byte {
+		envar := os.Getenv("SECRET_KEY")
+		if envar != "" {
+			return []byte(envar)
+		}
+		log.Warn().Msg("SECRET_KEY is not set, signed tokens are invalidated on restart")
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal().Err(err).Msg("failed to generate secret key")
+		}
+		return key
+	}()
+
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// HMAC-SHA256 of the data, the purpose separates the tokens of different usage
+func sign(purpose string, data []byte) []byte {
+	mac := hmac.New(sha256.New, SECRET_KEY)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// token in the form of "<base64 payload>.<base64 signature>"
+func signToken(purpose string, payload []byte) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(sign(purpose, payload))
+}
+
+// returns the payload of a valid token
+func verifyToken(purpose string, token string) ([]byte, error) {
+	enc := base64.RawURLEncoding
+	encPayload, encSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	payload, err := enc.DecodeString(encPayload)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signature, err := enc.DecodeString(encSignature)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, sign(purpose, payload)) {
+		return nil, ErrInvalidToken
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"main/internal/store"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ACCOUNT_NAME_MAX_LEN = 32
+
+	// name of the store document
+	accountDocument = "accounts"
+)
+
+var (
+	// sessions without an account are refused if it is set
+	AUTH_REQUIRED = os.Getenv("AUTH_REQUIRED") == "true"
+
+	ErrEmailTaken         = errors.New("email is registered already")
+	ErrInvalidEmail       = errors.New("invalid email")
+	ErrInvalidName        = fmt.Errorf("name should have 1 to %v characters", ACCOUNT_NAME_MAX_LEN)
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrAccountNotFound    = errors.New("account not found")
+
+	Accounts = NewAccountStore(store.Default)
+
+	// compared on unknown emails, so the response time does not tell whether an email is registered
+	dummyPasswordHash, _ = HashPassword("dummy password")
+)
+
+// Account is a registered user, the uid of the account is used as the uid of the sessions
+type Account struct {
+	UID          uuid.UUID
+	Email        string
+	Name         string
+	PasswordHash string `json:",omitempty"`
+	Subject      string `json:",omitempty"` // "<issuer>|<sub>" of the OIDC login
+	Created      int64  // unix milli
+	// the sessions issued before are revoked, unix milli
+	RevokedBefore int64 `json:",omitempty"`
+}
+
+type AccountStore struct {
+	sync.RWMutex
+	store    *store.Store
+	accounts map[uuid.UUID]*Account
+	emails   map[string]uuid.UUID
+	subjects map[string]uuid.UUID
+}
+
+func NewAccountStore(s *store.Store) *AccountStore {
+	accountStore := &AccountStore{
+		store:    s,
+		accounts: make(map[uuid.UUID]*Account),
+		emails:   make(map[string]uuid.UUID),
+		subjects: make(map[string]uuid.UUID),
+	}
+	accounts := []*Account{}
+	if err := s.Load(accountDocument, &accounts); err != nil {
+		log.Error().Err(err).Msg("[auth] failed to load accounts")
+	}
+	for _, account := range accounts {
+		accountStore.accounts[account.UID] = account
+		if account.Email != "" {
+			accountStore.emails[account.Email] = account.UID
+		}
+		if account.Subject != "" {
+			accountStore.subjects[account.Subject] = account.UID
+		}
+	}
+
+	return accountStore
+}
+
+// must be called with the lock held
+func (as *AccountStore) persist() error {
+	accounts := make([]*Account, 0, len(as.accounts))
+	for _, account := range as.accounts {
+		accounts = append(accounts, account)
+	}
+	if err := as.store.Save(accountDocument, accounts); err != nil {
+		log.Error().Err(err).Msg("[auth] failed to persist accounts")
+		return err
+	}
+	return nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+func validName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > ACCOUNT_NAME_MAX_LEN {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// Register creates an account with a new uid
+func (as *AccountStore) Register(email, name, password string) (Account, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return Account{}, err
+	}
+	name, err = validName(name)
+	if err != nil {
+		return Account{}, err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return Account{}, err
+	}
+
+	as.Lock()
+	defer as.Unlock()
+
+	if _, ok := as.emails[email]; ok {
+		return Account{}, ErrEmailTaken
+	}
+	account := &Account{
+		UID:          uuid.New(),
+		Email:        email,
+		Name:         name,
+		PasswordHash: hash,
+		Created:      time.Now().UnixMilli(),
+	}
+	as.accounts[account.UID] = account
+	as.emails[email] = account.UID
+	if err := as.persist(); err != nil {
+		delete(as.accounts, account.UID)
+		delete(as.emails, email)
+		return Account{}, err
+	}
+
+	return *account, nil
+}
+
+// LoginOIDC returns the account linked to the IdP subject, the account is created on the first login.
+// The name follows the IdP, the email is not registered so it does not collide with the password accounts
+func (as *AccountStore) LoginOIDC(issuer string, claims OIDCClaims) (Account, error) {
+	subject := issuer + "|" + claims.Subject
+	name := []rune(claims.DisplayName())
+	if len(name) > ACCOUNT_NAME_MAX_LEN {
+		name = name[:ACCOUNT_NAME_MAX_LEN]
+	}
+
+	as.Lock()
+	defer as.Unlock()
+
+	if uid, ok := as.subjects[subject]; ok {
+		account := as.accounts[uid]
+		if account.Name != string(name) {
+			old := account.Name
+			account.Name = string(name)
+			if err := as.persist(); err != nil {
+				account.Name = old
+			}
+		}
+		return *account, nil
+	}
+
+	account := &Account{
+		UID:     uuid.New(),
+		Name:    string(name),
+		Subject: subject,
+		Created: time.Now().UnixMilli(),
+	}
+	as.accounts[account.UID] = account
+	as.subjects[subject] = account.UID
+	if err := as.persist(); err != nil {
+		delete(as.accounts, account.UID)
+		delete(as.subjects, subject)
+		return Account{}, err
+	}
+
+	return *account, nil
+}
+
+// Authenticate returns the account of the email if the password matches
+func (as *AccountStore) Authenticate(email, password string) (Account, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return Account{}, ErrInvalidCredentials
+	}
+
+	as.RLock()
+	var account Account
+	if uid, ok := as.emails[email]; ok {
+		account = *as.accounts[uid]
+	}
+	as.RUnlock()
+
+	if account.PasswordHash == "" {
+		VerifyPassword(password, dummyPasswordHash)
+		return Account{}, ErrInvalidCredentials
+	}
+	if !VerifyPassword(password, account.PasswordHash) {
+		return Account{}, ErrInvalidCredentials
+	}
+
+	return account, nil
+}
+
+func (as *AccountStore) Get(uid uuid.UUID) (Account, bool) {
+	as.RLock()
+	defer as.RUnlock()
+
+	account, ok := as.accounts[uid]
+	if !ok {
+		return Account{}, false
+	}
+	return *account, true
+}
+
+// the uid belongs to an account, a session of it requires a session token
+func (as *AccountStore) Exists(uid uuid.UUID) bool {
+	as.RLock()
+	defer as.RUnlock()
+
+	_, ok := as.accounts[uid]
+	return ok
+}
+
+// Validate checks the session has not expired, and the account of it exists and has not revoked it
+func (as *AccountStore) Validate(session Session) bool {
+	if time.Now().After(session.Expiry) {
+		return false
+	}
+
+	as.RLock()
+	defer as.RUnlock()
+
+	account, ok := as.accounts[session.UID]
+	if !ok {
+		return false
+	}
+	return session.Issued.UnixMilli() >= account.RevokedBefore
+}
+
+// RevokeSessions invalidates every session of the account issued before now
+func (as *AccountStore) RevokeSessions(uid uuid.UUID) error {
+	as.Lock()
+	defer as.Unlock()
+
+	account, ok := as.accounts[uid]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	old := account.RevokedBefore
+	account.RevokedBefore = time.Now().UnixMilli()
+	if err := as.persist(); err != nil {
+		account.RevokedBefore = old
+		return err
+	}
+	return nil
+}
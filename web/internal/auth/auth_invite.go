@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	purposeInvite = "invite"
+)
+
+// Invite is the payload of an invite token, the uses and revocation are tracked by the room
+type Invite struct {
+	RID        uuid.UUID
+	ID         uuid.UUID
+	Expiry     time.Time
+	Permission int // 0 if the invite does not grant a permission
+}
+
+// InviteToken is shared by the host, it lets the holder join the room until the expiry
+func InviteToken(invite Invite) string {
+	payload := make([]byte, 0, 16+16+8+1)
+	payload = append(payload, invite.RID[:]...)
+	payload = append(payload, invite.ID[:]...)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(invite.Expiry.Unix()))
+	payload = append(payload, byte(invite.Permission))
+	return signToken(purposeInvite, payload)
+}
+
+// returns the invite of a valid token which has not expired
+func ParseInviteToken(token string) (Invite, error) {
+	payload, err := verifyToken(purposeInvite, token)
+	if err != nil || len(payload) != 16+16+8+1 {
+		return Invite{}, ErrInvalidToken
+	}
+	rid, err := uuid.FromBytes(payload[:16])
+	if err != nil {
+		return Invite{}, ErrInvalidToken
+	}
+	id, err := uuid.FromBytes(payload[16:32])
+	if err != nil {
+		return Invite{}, ErrInvalidToken
+	}
+	invite := Invite{
+		RID:        rid,
+		ID:         id,
+		Expiry:     time.Unix(int64(binary.BigEndian.Uint64(payload[32:40])), 0),
+		Permission: int(payload[40]),
+	}
+	if time.Now().After(invite.Expiry) {
+		return Invite{}, ErrInvalidToken
+	}
+	return invite, nil
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseInviteToken(t *testing.T) {
+	invite := Invite{
+		RID:        uuid.New(),
+		ID:         uuid.New(),
+		Expiry:     time.Now().Add(time.Hour).Truncate(time.Second),
+		Permission: 3,
+	}
+	claims, err := ParseInviteToken(InviteToken(invite))
+	if err != nil {
+		t.Fatalf("ParseInviteToken: %v", err)
+	}
+	if claims.RID != invite.RID || claims.ID != invite.ID || claims.Permission != invite.Permission ||
+		!claims.Expiry.Equal(invite.Expiry) {
+		t.Fatalf("claims = %+v, want %+v", claims, invite)
+	}
+}
+
+func TestParseInviteTokenExpired(t *testing.T) {
+	invite := Invite{
+		RID:    uuid.New(),
+		ID:     uuid.New(),
+		Expiry: time.Now().Add(-time.Second),
+	}
+	if _, err := ParseInviteToken(InviteToken(invite)); err != ErrInvalidToken {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestParseInviteTokenPurpose(t *testing.T) {
+	// a token signed for another purpose is not an invite, even with a payload of the same size
+	payload := make([]byte, 16+16+8+1)
+	if _, err := ParseInviteToken(signToken("other", payload)); err != ErrInvalidToken {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidToken)
+	}
+}
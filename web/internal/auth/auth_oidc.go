@@ -0,0 +1,433 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// the state of the login is bound to the browser which started it, see SetOIDCStateCookie
+	OIDC_STATE_COOKIE = "jukebox_oidc_state"
+	// the login has to be completed in time
+	OIDC_STATE_TTL = 10 * time.Minute
+	// upper bound of the pending logins, protects the memory from unfinished logins
+	OIDC_MAX_PENDING = 10000
+	// the keys are fetched again for an unknown kid after the interval
+	OIDC_JWKS_REFRESH_INTERVAL = time.Minute
+	OIDC_HTTP_TIMEOUT          = 10 * time.Second
+	// tolerance of the clock difference to the IdP
+	OIDC_CLOCK_SKEW = time.Minute
+
+	purposeOIDCState = "oidc_state"
+)
+
+var (
+	// the login is disabled if the issuer or the client id is not set
+	OIDC = NewOIDCProvider(
+		os.Getenv("OIDC_ISSUER"),
+		os.Getenv("OIDC_CLIENT_ID"),
+		os.Getenv("OIDC_CLIENT_SECRET"),
+		os.Getenv("OIDC_REDIRECT_URL"),
+	)
+
+	ErrOIDCState = errors.New("unknown or expired login state")
+)
+
+// OIDCProvider is an OpenID Connect relying party using the authorization code flow with PKCE
+type OIDCProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string // optional, public clients rely on PKCE only
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+
+	sync.Mutex
+	config      *oidcConfig
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+	pending     map[string]*oidcPending // state -> pending login
+}
+
+// the discovery document, only the used fields
+type oidcConfig struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcPending struct {
+	verifier string
+	nonce    string
+	redirect string
+	expiry   time.Time
+}
+
+// "aud" is either a string or an array of strings
+type audience []string
+
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*aud = multiple
+	return nil
+}
+
+// claims of the ID token
+type OIDCClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email"`
+}
+
+// the display name from the claims
+func (claims *OIDCClaims) DisplayName() string {
+	for _, name := range []string{claims.Name, claims.PreferredUsername, claims.Email} {
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+	return "user"
+}
+
+// returns nil if the issuer or the client id is empty
+func NewOIDCProvider(issuer, clientID, clientSecret, redirectURL string) *OIDCProvider {
+	if issuer == "" || clientID == "" {
+		return nil
+	}
+	if redirectURL == "" {
+		log.Warn().Msg("OIDC_REDIRECT_URL is not set, OIDC login is disabled")
+		return nil
+	}
+
+	return &OIDCProvider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       []string{"openid", "profile", "email"},
+		client:       &http.Client{Timeout: OIDC_HTTP_TIMEOUT},
+		keys:         make(map[string]crypto.PublicKey),
+		pending:      make(map[string]*oidcPending),
+	}
+}
+
+func (p *OIDCProvider) Issuer() string {
+	return p.issuer
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (p *OIDCProvider) getJson(ctx context.Context, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %v, url: %v", resp.Status, rawURL)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// the discovery document is fetched once
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcConfig, error) {
+	p.Lock()
+	config := p.config
+	p.Unlock()
+	if config != nil {
+		return config, nil
+	}
+
+	config = &oidcConfig{}
+	if err := p.getJson(ctx, p.issuer+"/.well-known/openid-configuration", config); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed, err: %v", err)
+	}
+	if strings.TrimSuffix(config.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc issuer mismatch, expected: %v, got: %v", p.issuer, config.Issuer)
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is incomplete")
+	}
+
+	p.Lock()
+	p.config = config
+	p.Unlock()
+	return config, nil
+}
+
+// returns the signing key of the kid, the keys are fetched again for an unknown kid
+func (p *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.keysFetched) > OIDC_JWKS_REFRESH_INTERVAL
+	p.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, ErrUnknownKey
+	}
+
+	config, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var jwks JWKS
+	if err := p.getJson(ctx, config.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks, err: %v", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pub, err := jwk.PublicKey()
+		if err != nil {
+			log.Debug().Err(err).Str("kid", jwk.Kid).Msg("[oidc] skipped jwk")
+			continue
+		}
+		keys[jwk.Kid] = pub
+	}
+
+	p.Lock()
+	p.keys = keys
+	p.keysFetched = time.Now()
+	p.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// AuthURL starts a login, the user is redirected to the returned url of the IdP.
+// redirect is the local path to return to after the login,
+// the returned state has to be bound to the browser with SetOIDCStateCookie
+func (p *OIDCProvider) AuthURL(ctx context.Context, redirect string) (string, string, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state := randomString(32)
+	pending := &oidcPending{
+		verifier: randomString(32),
+		nonce:    randomString(16),
+		redirect: redirect,
+		expiry:   time.Now().Add(OIDC_STATE_TTL),
+	}
+	p.Lock()
+	now := time.Now()
+	for s, pen := range p.pending {
+		if now.After(pen.expiry) {
+			delete(p.pending, s)
+		}
+	}
+	if len(p.pending) >= OIDC_MAX_PENDING {
+		p.Unlock()
+		return "", "", errors.New("too many pending logins")
+	}
+	p.pending[state] = pending
+	p.Unlock()
+
+	challenge := sha256.Sum256([]byte(pending.verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {pending.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL, err := url.Parse(config.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", err
+	}
+	if authURL.RawQuery != "" {
+		authURL.RawQuery += "&"
+	}
+	authURL.RawQuery += query.Encode()
+
+	return authURL.String(), state, nil
+}
+
+// the cookie holds the signed hash of the state and the expiry,
+// a callback with a state started in another browser is refused (login CSRF)
+func SetOIDCStateCookie(w http.ResponseWriter, r *http.Request, state string) {
+	expiry := time.Now().Add(OIDC_STATE_TTL)
+	hash := sha256.Sum256([]byte(state))
+	payload := make([]byte, 0, sha256.Size+8)
+	payload = append(payload, hash[:]...)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(expiry.Unix()))
+	cookie := http.Cookie{
+		Name:     OIDC_STATE_COOKIE,
+		Value:    signToken(purposeOIDCState, payload),
+		Path:     "/api/oidc",
+		MaxAge:   int(OIDC_STATE_TTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secure(r),
+		// sent on the top-level redirect from the IdP
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// the state matches the state cookie of the browser and has not expired
+func VerifyOIDCStateCookie(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(OIDC_STATE_COOKIE)
+	if err != nil {
+		return false
+	}
+	payload, err := verifyToken(purposeOIDCState, cookie.Value)
+	if err != nil || len(payload) != sha256.Size+8 {
+		return false
+	}
+	expiry := time.Unix(int64(binary.BigEndian.Uint64(payload[sha256.Size:])), 0)
+	if time.Now().After(expiry) {
+		return false
+	}
+	hash := sha256.Sum256([]byte(state))
+	return hmac.Equal(payload[:sha256.Size], hash[:])
+}
+
+func ClearOIDCStateCookie(w http.ResponseWriter, r *http.Request) {
+	cookie := http.Cookie{
+		Name:     OIDC_STATE_COOKIE,
+		Value:    "",
+		Path:     "/api/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// Exchange completes the login of the state, the code is exchanged for the ID token and verified.
+// Returns the claims and the redirect path given to AuthURL
+func (p *OIDCProvider) Exchange(ctx context.Context, state, code string) (OIDCClaims, string, error) {
+	p.Lock()
+	pending, ok := p.pending[state]
+	delete(p.pending, state)
+	p.Unlock()
+	if !ok || time.Now().After(pending.expiry) {
+		return OIDCClaims{}, "", ErrOIDCState
+	}
+
+	config, err := p.discover(ctx)
+	if err != nil {
+		return OIDCClaims{}, "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {pending.verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCClaims{}, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return OIDCClaims{}, "", fmt.Errorf("oidc token request failed, err: %v", err)
+	}
+	defer resp.Body.Close()
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResp); err != nil {
+		return OIDCClaims{}, "", fmt.Errorf("oidc token response decode error, status: %v, err: %v", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResp.IDToken == "" {
+		return OIDCClaims{}, "", fmt.Errorf("oidc token request failed, status: %v, err: %v %v", resp.Status, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+
+	claims, err := p.verifyIDToken(ctx, tokenResp.IDToken, pending.nonce)
+	if err != nil {
+		return OIDCClaims{}, "", err
+	}
+	return claims, pending.redirect, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, idToken, nonce string) (OIDCClaims, error) {
+	var claims OIDCClaims
+	keyFunc := func(kid string) (crypto.PublicKey, error) {
+		return p.key(ctx, kid)
+	}
+	if err := verifyJWT(idToken, keyFunc, &claims); err != nil {
+		return OIDCClaims{}, fmt.Errorf("invalid id token, err: %v", err)
+	}
+
+	now := time.Now()
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.issuer:
+		return OIDCClaims{}, fmt.Errorf("id token issuer mismatch: %v", claims.Issuer)
+	case !slices.Contains(claims.Audience, p.clientID):
+		return OIDCClaims{}, fmt.Errorf("id token audience mismatch: %v", claims.Audience)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID:
+		return OIDCClaims{}, fmt.Errorf("id token authorized party mismatch: %v", claims.AuthorizedParty)
+	case now.After(time.Unix(claims.Expiry, 0).Add(OIDC_CLOCK_SKEW)):
+		return OIDCClaims{}, errors.New("id token expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(OIDC_CLOCK_SKEW)):
+		return OIDCClaims{}, errors.New("id token issued in the future")
+	case claims.Nonce != nonce:
+		return OIDCClaims{}, errors.New("id token nonce mismatch")
+	case claims.Subject == "":
+		return OIDCClaims{}, errors.New("id token has no subject")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// OWASP recommendation of PBKDF2-HMAC-SHA256
+	PASSWORD_ITERATIONS = 600_000
+	PASSWORD_SALT_LEN   = 16
+	PASSWORD_KEY_LEN    = 32
+	PASSWORD_MIN_LEN    = 8
+	PASSWORD_MAX_LEN    = 128
+
+	passwordScheme = "pbkdf2-sha256"
+)
+
+var (
+	ErrPasswordLength = fmt.Errorf("password should have %v to %v characters", PASSWORD_MIN_LEN, PASSWORD_MAX_LEN)
+)
+
+// HashPassword returns the encoded hash in the form of "pbkdf2-sha256$<iterations>$<salt>$<key>"
+func HashPassword(password string) (string, error) {
+	if len(password) < PASSWORD_MIN_LEN || len(password) > PASSWORD_MAX_LEN {
+		return "", ErrPasswordLength
+	}
+	salt := make([]byte, PASSWORD_SALT_LEN)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, PASSWORD_ITERATIONS, PASSWORD_KEY_LEN)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%v$%v$%v$%v", passwordScheme, PASSWORD_ITERATIONS, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// VerifyPassword compares the password with the encoded hash in constant time
+func VerifyPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"crypto/hmac"
+
+	"github.com/google/uuid"
+)
+
+const (
+	purposeResume = "resume"
+)
+
+// ResumeToken lets the client reconnect its websocket to the session after a disconnection
+func ResumeToken(uid uuid.UUID, sid uuid.UUID) string {
+	payload := make([]byte, 0, 32)
+	payload = append(payload, uid[:]...)
+	payload = append(payload, sid[:]...)
+	return signToken(purposeResume, payload)
+}
+
+// the token is valid if it is issued for the uid and sid
+func VerifyResumeToken(token string, uid uuid.UUID, sid uuid.UUID) bool {
+	payload, err := verifyToken(purposeResume, token)
+	if err != nil || len(payload) != 32 {
+		return false
+	}
+	return hmac.Equal(payload[:16], uid[:]) && hmac.Equal(payload[16:], sid[:])
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"encoding/binary"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	SESSION_COOKIE = "jukebox_session"
+
+	purposeSession = "session"
+)
+
+var (
+	SESSION_TOKEN_TTL = func() time.Duration {
+		envar := os.Getenv("SESSION_TOKEN_TTL")
+		if envar == "" {
+			return 7 * 24 * time.Hour
+		}
+		ttl, err := time.ParseDuration(envar)
+		if err != nil || ttl <= 0 {
+			log.Error().Err(err).Msg("Invalid env: SESSION_TOKEN_TTL")
+			return 7 * 24 * time.Hour
+		}
+		return ttl
+	}()
+)
+
+// Session is the payload of a session token
+type Session struct {
+	UID    uuid.UUID
+	Issued time.Time
+	Expiry time.Time
+}
+
+// SessionToken is issued on login, it is valid until the expiry unless the account revokes it
+func SessionToken(session Session) string {
+	payload := make([]byte, 0, len(session.UID)+16)
+	payload = append(payload, session.UID[:]...)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(session.Issued.UnixMilli()))
+	payload = binary.BigEndian.AppendUint64(payload, uint64(session.Expiry.Unix()))
+	return signToken(purposeSession, payload)
+}
+
+// returns the session of a valid token which has not expired,
+// use Accounts.Validate() to check the account of the session
+func ParseSessionToken(token string) (Session, error) {
+	payload, err := verifyToken(purposeSession, token)
+	if err != nil || len(payload) != 16+16 {
+		return Session{}, ErrInvalidToken
+	}
+	uid, err := uuid.FromBytes(payload[:16])
+	if err != nil {
+		return Session{}, ErrInvalidToken
+	}
+	session := Session{
+		UID:    uid,
+		Issued: time.UnixMilli(int64(binary.BigEndian.Uint64(payload[16:24]))),
+		Expiry: time.Unix(int64(binary.BigEndian.Uint64(payload[24:])), 0),
+	}
+	if time.Now().After(session.Expiry) {
+		return Session{}, ErrInvalidToken
+	}
+	return session, nil
+}
+
+// issue a session token and set it as the session cookie, the token is returned for non-browser clients
+func SetSessionCookie(w http.ResponseWriter, r *http.Request, uid uuid.UUID) (string, Session) {
+	now := time.Now()
+	session := Session{
+		UID:    uid,
+		Issued: now,
+		Expiry: now.Add(SESSION_TOKEN_TTL),
+	}
+	token := SessionToken(session)
+	cookie := http.Cookie{
+		Name:     SESSION_COOKIE,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.Expiry,
+		HttpOnly: true,
+		Secure:   secure(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &cookie)
+
+	return token, session
+}
+
+func ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	cookie := http.Cookie{
+		Name:     SESSION_COOKIE,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// returns the session of the request from the "Authorization: Bearer" header or the session cookie,
+// the account of the session is validated. False if there is no valid session
+func SessionFromRequest(r *http.Request) (Session, bool) {
+	token := ""
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = strings.TrimSpace(bearer)
+	} else if cookie, err := r.Cookie(SESSION_COOKIE); err == nil {
+		token = cookie.Value
+	}
+	if token == "" {
+		return Session{}, false
+	}
+	session, err := ParseSessionToken(token)
+	if err != nil {
+		return Session{}, false
+	}
+	if !Accounts.Validate(session) {
+		return Session{}, false
+	}
+	return session, true
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestSignToken(t *testing.T) {
+	token := signToken("test", []byte("payload"))
+	payload, err := verifyToken("test", token)
+	if err != nil {
+		t.Fatalf("verifyToken: %v", err)
+	}
+	if string(payload) != "payload" {
+		t.Fatalf("payload = %q, want %q", payload, "payload")
+	}
+}
+
+func TestVerifyTokenInvalid(t *testing.T) {
+	token := signToken("test", []byte("payload"))
+	_, signature, _ := strings.Cut(token, ".")
+	tampered := base64.RawURLEncoding.EncodeToString([]byte("payloaf")) + "." + signature
+	// the last character of the signature carries padding bits, the first one is changed
+	flipped := []byte(signature)
+	flipped[0] ^= 'A' ^ 'B'
+
+	tests := []struct {
+		name    string
+		purpose string
+		token   string
+	}{
+		{"purpose", "other", token},
+		{"payload", "test", tampered},
+		{"signature", "test", strings.Split(token, ".")[0] + "." + string(flipped)},
+		{"no signature", "test", strings.Split(token, ".")[0]},
+		{"encoding", "test", "!!." + signature},
+		{"empty", "test", ""},
+	}
+	for _, tt := range tests {
+		if _, err := verifyToken(tt.purpose, tt.token); err != ErrInvalidToken {
+			t.Errorf("%v: err = %v, want %v", tt.name, err, ErrInvalidToken)
+		}
+	}
+}
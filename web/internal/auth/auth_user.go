@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	USER_COOKIE         = "jukebox_user"
+	USER_COOKIE_MAX_AGE = 365 * 24 * time.Hour
+
+	purposeUser = "user"
+)
+
+// UserToken binds the uid to the browser, the uid alone is only an identifier chosen by the client
+func UserToken(uid uuid.UUID) string {
+	return signToken(purposeUser, uid[:])
+}
+
+func ParseUserToken(token string) (uuid.UUID, error) {
+	payload, err := verifyToken(purposeUser, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	uid, err := uuid.FromBytes(payload)
+	if err != nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+	return uid, nil
+}
+
+// the request is served over https directly or behind the proxy
+func secure(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func SetUserCookie(w http.ResponseWriter, r *http.Request, uid uuid.UUID) {
+	cookie := http.Cookie{
+		Name:     USER_COOKIE,
+		Value:    UserToken(uid),
+		Path:     "/",
+		MaxAge:   int(USER_COOKIE_MAX_AGE.Seconds()),
+		HttpOnly: true,
+		Secure:   secure(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// returns the uid of the user cookie, false if the cookie is missing or invalid
+func UserFromCookie(r *http.Request) (uuid.UUID, bool) {
+	cookie, err := r.Cookie(USER_COOKIE)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	uid, err := ParseUserToken(cookie.Value)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return uid, true
+}
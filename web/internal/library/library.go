@@ -0,0 +1,227 @@
+package library
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// library reference accepted by the sources, "library:<id>"
+	REF_SCHEME = "library"
+
+	SEARCH_MAX_RESULTS = 50
+)
+
+var (
+	LIBRARY_DIR = os.Getenv("LIBRARY_DIR")
+
+	LIBRARY_RESCAN_INTERVAL = func() time.Duration {
+		envar := os.Getenv("LIBRARY_RESCAN_INTERVAL")
+		if envar == "" {
+			return 10 * time.Minute
+		}
+		d, err := time.ParseDuration(envar)
+		if err != nil || d <= 0 {
+			log.Error().Err(err).Msg("Invalid env: LIBRARY_RESCAN_INTERVAL")
+			return 10 * time.Minute
+		}
+		return d
+	}()
+
+	// nil if LIBRARY_DIR is not configured
+	Default *Library = func() *Library {
+		if LIBRARY_DIR == "" {
+			return nil
+		}
+		return New(LIBRARY_DIR)
+	}()
+
+	// file extensions with a tag reader
+	extensions = map[string]bool{
+		".flac": true,
+		".m4a":  true,
+		".mp3":  true,
+		".oga":  true,
+		".ogg":  true,
+		".opus": true,
+		".wav":  true,
+	}
+)
+
+// Supported reports whether the tags of the file can be read
+func Supported(path string) bool {
+	return extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+type Track struct {
+	ID       string
+	Title    string
+	Artist   string
+	Album    string
+	Duration int
+	Path     string `json:"-"`
+
+	modTime time.Time
+	search  string // lower case text for searching
+}
+
+func (t *Track) Ref() string {
+	return REF_SCHEME + ":" + t.ID
+}
+
+// Library indexes the audio files under a directory
+type Library struct {
+	sync.RWMutex
+	dir    string
+	tracks map[string]*Track // id -> track
+}
+
+func New(dir string) *Library {
+	return &Library{
+		dir:    filepath.Clean(dir),
+		tracks: make(map[string]*Track),
+	}
+}
+
+// the id is derived from the relative path, it is stable between scans
+func trackID(rel string) string {
+	sum := sha1.Sum([]byte(filepath.ToSlash(rel)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Scan walks the directory and reindex the tracks, unchanged files are not parsed again
+func (lib *Library) Scan() error {
+	lib.RLock()
+	prev := lib.tracks
+	lib.RUnlock()
+
+	tracks := make(map[string]*Track, len(prev))
+	err := filepath.WalkDir(lib.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("[library] walk error")
+			return nil
+		}
+		if d.IsDir() || !Supported(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(lib.dir, path)
+		if err != nil {
+			return nil
+		}
+
+		id := trackID(rel)
+		if t, ok := prev[id]; ok && t.modTime.Equal(info.ModTime()) {
+			tracks[id] = t
+			return nil
+		}
+
+		tags, err := ReadTags(path)
+		if err != nil {
+			log.Debug().Err(err).Str("path", path).Msg("[library] failed to read tags")
+		}
+		name := filepath.Base(rel)
+		if tags.Title == "" {
+			tags.Title = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		tracks[id] = &Track{
+			ID:       id,
+			Title:    tags.Title,
+			Artist:   tags.Artist,
+			Album:    tags.Album,
+			Duration: tags.Duration,
+			Path:     path,
+			modTime:  info.ModTime(),
+			search:   strings.ToLower(strings.Join([]string{tags.Title, tags.Artist, tags.Album, rel}, " ")),
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	lib.Lock()
+	lib.tracks = tracks
+	lib.Unlock()
+	log.Info().Str("dir", lib.dir).Int("tracks", len(tracks)).Msg("[library] scan finished")
+
+	return nil
+}
+
+// Run scans the library periodically
+func (lib *Library) Run(ctx context.Context) {
+	ticker := time.NewTicker(LIBRARY_RESCAN_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		if err := lib.Scan(); err != nil {
+			log.Error().Err(err).Str("dir", lib.dir).Msg("[library] scan error")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (lib *Library) Get(id string) (Track, bool) {
+	lib.RLock()
+	defer lib.RUnlock()
+
+	t, ok := lib.tracks[id]
+	if !ok {
+		return Track{}, false
+	}
+	return *t, true
+}
+
+// Search returns the tracks containing every word of the query,
+// sorted by artist and title
+func (lib *Library) Search(query string, limit int) []Track {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return []Track{}
+	}
+
+	lib.RLock()
+	ret := []Track{}
+	for _, t := range lib.tracks {
+		match := true
+		for _, w := range words {
+			if !strings.Contains(t.search, w) {
+				match = false
+				break
+			}
+		}
+		if match {
+			ret = append(ret, *t)
+		}
+	}
+	lib.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Artist != ret[j].Artist {
+			return ret[i].Artist < ret[j].Artist
+		}
+		return ret[i].Title < ret[j].Title
+	})
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+
+	return ret
+}
@@ -0,0 +1,767 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+/*
+	Minimal tag readers of the common audio formats,
+	only title, artist, album and duration are extracted
+*/
+
+const (
+	// upper bound of a metadata section, e.g. ID3v2 tag, mp4 moov box
+	maxTagSize = 4 << 20
+)
+
+var (
+	errUnknownFormat = errors.New("unknown audio format")
+)
+
+type Tags struct {
+	Title    string
+	Artist   string
+	Album    string
+	Duration int // seconds
+}
+
+func ReadTags(path string) (Tags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Tags{}, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return Tags{}, err
+	}
+
+	return readTags(f, stat.Size(), strings.ToLower(filepath.Ext(path)))
+}
+
+func readTags(r io.ReaderAt, size int64, ext string) (Tags, error) {
+	magic := make([]byte, 12)
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return Tags{}, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("fLaC")):
+		return readFLAC(r, size)
+	case bytes.HasPrefix(magic, []byte("OggS")):
+		return readOgg(r, size)
+	case bytes.HasPrefix(magic, []byte("RIFF")) && bytes.Equal(magic[8:12], []byte("WAVE")):
+		return readWAV(r, size)
+	case bytes.Equal(magic[4:8], []byte("ftyp")):
+		return readMP4(r, size)
+	case bytes.HasPrefix(magic, []byte("ID3")) || ext == ".mp3":
+		return readMP3(r, size)
+	}
+
+	return Tags{}, errUnknownFormat
+}
+
+// read n bytes at off, n is bounded by maxTagSize
+func readSection(r io.ReaderAt, off int64, n int64) ([]byte, error) {
+	if n < 0 || n > maxTagSize {
+		return nil, fmt.Errorf("invalid section size: %v", n)
+	}
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, off)
+	if err != nil && !(err == io.EOF && int64(read) == n) {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func trimText(s string) string {
+	return strings.TrimSpace(strings.Trim(s, "\x00"))
+}
+
+/*
+	MP3: ID3v2, ID3v1 and MPEG frame header
+*/
+
+func syncsafe(b []byte) int64 {
+	return int64(b[0]&0x7f)<<21 | int64(b[1]&0x7f)<<14 | int64(b[2]&0x7f)<<7 | int64(b[3]&0x7f)
+}
+
+func decodeID3Text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	enc, b := b[0], b[1:]
+	switch enc {
+	case 1, 2:
+		// UTF-16 with BOM, UTF-16BE
+		bigEndian := enc == 2
+		if len(b) >= 2 {
+			if b[0] == 0xff && b[1] == 0xfe {
+				bigEndian = false
+				b = b[2:]
+			} else if b[0] == 0xfe && b[1] == 0xff {
+				bigEndian = true
+				b = b[2:]
+			}
+		}
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			var c uint16
+			if bigEndian {
+				c = binary.BigEndian.Uint16(b[i:])
+			} else {
+				c = binary.LittleEndian.Uint16(b[i:])
+			}
+			if c == 0 {
+				break
+			}
+			u = append(u, c)
+		}
+		return trimText(string(utf16.Decode(u)))
+	case 3:
+		return trimText(string(b))
+	default:
+		// ISO-8859-1
+		runes := make([]rune, 0, len(b))
+		for _, c := range b {
+			if c == 0 {
+				break
+			}
+			runes = append(runes, rune(c))
+		}
+		return trimText(string(runes))
+	}
+}
+
+// returns the tags and the size of the ID3v2 tag
+func readID3v2(r io.ReaderAt) (Tags, int64, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return Tags{}, 0, err
+	}
+	if !bytes.HasPrefix(header, []byte("ID3")) {
+		return Tags{}, 0, nil
+	}
+	version := header[3]
+	flags := header[5]
+	tagSize := syncsafe(header[6:10])
+	total := 10 + tagSize
+	if flags&0x10 != 0 {
+		// footer
+		total += 10
+	}
+
+	body, err := readSection(r, 10, tagSize)
+	if err != nil {
+		return Tags{}, total, err
+	}
+	if flags&0x40 != 0 && len(body) >= 4 {
+		// skip extended header
+		var extSize int64
+		if version == 4 {
+			extSize = syncsafe(body[:4])
+		} else {
+			extSize = int64(binary.BigEndian.Uint32(body[:4])) + 4
+		}
+		if extSize > int64(len(body)) {
+			return Tags{}, total, errors.New("invalid ID3v2 extended header")
+		}
+		body = body[extSize:]
+	}
+
+	tags := Tags{}
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for len(body) >= headerLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var frameSize int64
+		switch version {
+		case 2:
+			frameSize = int64(body[3])<<16 | int64(body[4])<<8 | int64(body[5])
+		case 4:
+			frameSize = syncsafe(body[4:8])
+		default:
+			frameSize = int64(binary.BigEndian.Uint32(body[4:8]))
+		}
+		if frameSize > int64(len(body)-headerLen) {
+			break
+		}
+		frame := body[headerLen : int64(headerLen)+frameSize]
+		switch id {
+		case "TIT2", "TT2":
+			tags.Title = decodeID3Text(frame)
+		case "TPE1", "TP1":
+			tags.Artist = decodeID3Text(frame)
+		case "TALB", "TAL":
+			tags.Album = decodeID3Text(frame)
+		case "TLEN", "TLE":
+			if ms, err := strconv.Atoi(decodeID3Text(frame)); err == nil {
+				tags.Duration = ms / 1000
+			}
+		}
+		body = body[int64(headerLen)+frameSize:]
+	}
+
+	return tags, total, nil
+}
+
+func readID3v1(r io.ReaderAt, size int64) Tags {
+	if size < 128 {
+		return Tags{}
+	}
+	b := make([]byte, 128)
+	if _, err := r.ReadAt(b, size-128); err != nil || !bytes.HasPrefix(b, []byte("TAG")) {
+		return Tags{}
+	}
+	return Tags{
+		Title:  decodeID3Text(append([]byte{0}, b[3:33]...)),
+		Artist: decodeID3Text(append([]byte{0}, b[33:63]...)),
+		Album:  decodeID3Text(append([]byte{0}, b[63:93]...)),
+	}
+}
+
+var (
+	mpegSampleRates = [4][3]int{
+		{11025, 12000, 8000},  // MPEG 2.5
+		{},                    // reserved
+		{22050, 24000, 16000}, // MPEG 2
+		{44100, 48000, 32000}, // MPEG 1
+	}
+	// kbps, [MPEG1?][layer index]
+	mpegBitrates = [2][3][16]int{
+		{ // MPEG 2, 2.5
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},      // layer III
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},      // layer II
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256}, // layer I
+		},
+		{ // MPEG 1
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},     // layer III
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},    // layer II
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448}, // layer I
+		},
+	}
+)
+
+type mpegHeader struct {
+	versionBits     uint32
+	layerBits       uint32
+	channelMode     uint32
+	sampleRate      int
+	bitrate         int // bps
+	samplesPerFrame int
+	frameSize       int // bytes, including the header
+}
+
+func (h mpegHeader) mpeg1() bool {
+	return h.versionBits == 3
+}
+
+func parseMPEGHeader(b []byte) (mpegHeader, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return mpegHeader{}, false
+	}
+	h := binary.BigEndian.Uint32(b)
+	versionBits := (h >> 19) & 0x3
+	layerBits := (h >> 17) & 0x3
+	bitrateIdx := (h >> 12) & 0xf
+	rateIdx := (h >> 10) & 0x3
+	padding := int((h >> 9) & 0x1)
+	if versionBits == 1 || layerBits == 0 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return mpegHeader{}, false
+	}
+	hdr := mpegHeader{
+		versionBits: versionBits,
+		layerBits:   layerBits,
+		channelMode: (h >> 6) & 0x3,
+		sampleRate:  mpegSampleRates[versionBits][rateIdx],
+	}
+	v := 0
+	if hdr.mpeg1() {
+		v = 1
+	}
+	hdr.bitrate = mpegBitrates[v][layerBits-1][bitrateIdx] * 1000
+
+	switch {
+	case layerBits == 3:
+		hdr.samplesPerFrame = 384
+		hdr.frameSize = (12*hdr.bitrate/hdr.sampleRate + padding) * 4
+	case layerBits == 1 && !hdr.mpeg1():
+		hdr.samplesPerFrame = 576
+		hdr.frameSize = 72*hdr.bitrate/hdr.sampleRate + padding
+	default:
+		hdr.samplesPerFrame = 1152
+		hdr.frameSize = 144*hdr.bitrate/hdr.sampleRate + padding
+	}
+	return hdr, true
+}
+
+// find the first MPEG frame, the frame sync is only accepted if the next frame follows it
+func findMPEGFrame(buf []byte) (int, mpegHeader, bool) {
+	for i := 0; i+4 <= len(buf); i++ {
+		hdr, ok := parseMPEGHeader(buf[i:])
+		if !ok {
+			continue
+		}
+		next := i + hdr.frameSize
+		if next+4 > len(buf) {
+			// the next frame is not buffered, a single frame is accepted at the end of the file
+			return i, hdr, next <= len(buf)
+		}
+		if nextHdr, ok := parseMPEGHeader(buf[next:]); ok &&
+			nextHdr.versionBits == hdr.versionBits &&
+			nextHdr.layerBits == hdr.layerBits &&
+			nextHdr.sampleRate == hdr.sampleRate {
+			return i, hdr, true
+		}
+	}
+	return 0, mpegHeader{}, false
+}
+
+// estimate the duration from the first MPEG frame, Xing/VBRI header is used if present.
+// Returns false if no MPEG frame is found
+func mp3Duration(r io.ReaderAt, start, size int64) (int, bool) {
+	buf, err := readSection(r, start, min(size-start, 64<<10))
+	if err != nil {
+		return 0, false
+	}
+	i, hdr, ok := findMPEGFrame(buf)
+	if !ok {
+		return 0, false
+	}
+
+	// Xing/Info header after the side info
+	mpeg1 := hdr.mpeg1()
+	sideInfo := 32
+	switch {
+	case mpeg1 && hdr.channelMode == 3:
+		sideInfo = 17
+	case !mpeg1 && hdr.channelMode != 3:
+		sideInfo = 17
+	case !mpeg1 && hdr.channelMode == 3:
+		sideInfo = 9
+	}
+	if x := i + 4 + sideInfo; x+12 <= len(buf) {
+		tag := string(buf[x : x+4])
+		if (tag == "Xing" || tag == "Info") && buf[x+7]&0x1 != 0 {
+			frames := binary.BigEndian.Uint32(buf[x+8:])
+			return int(int64(frames) * int64(hdr.samplesPerFrame) / int64(hdr.sampleRate)), true
+		}
+	}
+	if x := i + 4 + 32; x+18 <= len(buf) && string(buf[x:x+4]) == "VBRI" {
+		frames := binary.BigEndian.Uint32(buf[x+14:])
+		return int(int64(frames) * int64(hdr.samplesPerFrame) / int64(hdr.sampleRate)), true
+	}
+
+	// constant bitrate
+	return int((size - start - int64(i)) * 8 / int64(hdr.bitrate)), true
+}
+
+func readMP3(r io.ReaderAt, size int64) (Tags, error) {
+	tags, id3Size, err := readID3v2(r)
+	if err != nil {
+		return Tags{}, err
+	}
+	if tags.Title == "" && tags.Artist == "" {
+		v1 := readID3v1(r, size)
+		tags.Title, tags.Artist, tags.Album = v1.Title, v1.Artist, v1.Album
+	}
+	// the audio frames are required, the extension or the ID3 tag alone is not an audio file
+	duration, ok := mp3Duration(r, id3Size, size)
+	if !ok {
+		return Tags{}, errors.New("MPEG audio frame not found")
+	}
+	if tags.Duration == 0 {
+		tags.Duration = duration
+	}
+
+	return tags, nil
+}
+
+/*
+	Vorbis comment: FLAC, Ogg Vorbis, Opus
+*/
+
+func parseVorbisComment(b []byte, tags *Tags) {
+	if len(b) < 4 {
+		return
+	}
+	vendorLen := int64(binary.LittleEndian.Uint32(b))
+	if 4+vendorLen+4 > int64(len(b)) {
+		return
+	}
+	b = b[4+vendorLen:]
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for i := uint32(0); i < count && len(b) >= 4; i++ {
+		n := int64(binary.LittleEndian.Uint32(b))
+		if 4+n > int64(len(b)) {
+			return
+		}
+		key, val, ok := strings.Cut(string(b[4:4+n]), "=")
+		b = b[4+n:]
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			tags.Title = trimText(val)
+		case "ARTIST":
+			tags.Artist = trimText(val)
+		case "ALBUM":
+			tags.Album = trimText(val)
+		}
+	}
+}
+
+func readFLAC(r io.ReaderAt, size int64) (Tags, error) {
+	tags := Tags{}
+	streamInfo := false
+	off := int64(4)
+	header := make([]byte, 4)
+	for off+4 <= size {
+		if _, err := r.ReadAt(header, off); err != nil {
+			return tags, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		blockLen := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		off += 4
+
+		switch blockType {
+		case 0: // STREAMINFO
+			b, err := readSection(r, off, blockLen)
+			if err != nil || len(b) < 18 {
+				return tags, errors.New("invalid FLAC STREAMINFO")
+			}
+			sampleRate := int64(b[10])<<12 | int64(b[11])<<4 | int64(b[12])>>4
+			totalSamples := int64(b[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(b[14:]))
+			if sampleRate > 0 {
+				tags.Duration = int(totalSamples / sampleRate)
+			}
+			streamInfo = true
+		case 4: // VORBIS_COMMENT
+			b, err := readSection(r, off, blockLen)
+			if err != nil {
+				return tags, err
+			}
+			parseVorbisComment(b, &tags)
+		}
+
+		off += blockLen
+		if last {
+			break
+		}
+	}
+	if !streamInfo {
+		return tags, errors.New("missing FLAC STREAMINFO")
+	}
+
+	return tags, nil
+}
+
+// reassemble the first n packets of the first logical stream
+func oggPackets(r io.ReaderAt, size int64, n int) ([][]byte, error) {
+	packets := [][]byte{}
+	cur := []byte{}
+	off := int64(0)
+	header := make([]byte, 27)
+	for off+27 <= size && len(packets) < n {
+		if _, err := r.ReadAt(header, off); err != nil {
+			return packets, err
+		}
+		if !bytes.HasPrefix(header, []byte("OggS")) {
+			return packets, errors.New("invalid Ogg page")
+		}
+		segments := int64(header[26])
+		table, err := readSection(r, off+27, segments)
+		if err != nil {
+			return packets, err
+		}
+		var bodyLen int64
+		for _, l := range table {
+			bodyLen += int64(l)
+		}
+		body, err := readSection(r, off+27+segments, bodyLen)
+		if err != nil {
+			return packets, err
+		}
+		for _, l := range table {
+			cur = append(cur, body[:l]...)
+			body = body[l:]
+			if len(cur) > maxTagSize {
+				return packets, errors.New("Ogg packet is too large")
+			}
+			if l < 255 {
+				packets = append(packets, cur)
+				cur = []byte{}
+				if len(packets) == n {
+					break
+				}
+			}
+		}
+		off += 27 + segments + bodyLen
+	}
+
+	return packets, nil
+}
+
+// granule position of the last page
+func oggLastGranule(r io.ReaderAt, size int64) int64 {
+	tailLen := min(size, 64<<10)
+	tail, err := readSection(r, size-tailLen, tailLen)
+	if err != nil {
+		return 0
+	}
+	i := bytes.LastIndex(tail, []byte("OggS"))
+	if i < 0 || i+14 > len(tail) {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(tail[i+6:]))
+}
+
+func readOgg(r io.ReaderAt, size int64) (Tags, error) {
+	packets, err := oggPackets(r, size, 2)
+	if err != nil && len(packets) < 2 {
+		return Tags{}, err
+	}
+	if len(packets) < 2 {
+		return Tags{}, errors.New("missing Ogg header packets")
+	}
+	id, comment := packets[0], packets[1]
+
+	tags := Tags{}
+	granule := oggLastGranule(r, size)
+	switch {
+	case bytes.HasPrefix(id, []byte("\x01vorbis")) && len(id) >= 16:
+		sampleRate := int64(binary.LittleEndian.Uint32(id[12:]))
+		if sampleRate > 0 {
+			tags.Duration = int(granule / sampleRate)
+		}
+		if bytes.HasPrefix(comment, []byte("\x03vorbis")) {
+			parseVorbisComment(comment[7:], &tags)
+		}
+	case bytes.HasPrefix(id, []byte("OpusHead")) && len(id) >= 12:
+		preSkip := int64(binary.LittleEndian.Uint16(id[10:]))
+		tags.Duration = int(max(granule-preSkip, 0) / 48000)
+		if bytes.HasPrefix(comment, []byte("OpusTags")) {
+			parseVorbisComment(comment[8:], &tags)
+		}
+	default:
+		return Tags{}, errUnknownFormat
+	}
+
+	return tags, nil
+}
+
+/*
+	WAV: RIFF chunks
+*/
+
+func readWAV(r io.ReaderAt, size int64) (Tags, error) {
+	tags := Tags{}
+	var byteRate, dataLen int64
+	off := int64(12)
+	header := make([]byte, 8)
+	for off+8 <= size {
+		if _, err := r.ReadAt(header, off); err != nil {
+			return tags, err
+		}
+		id := string(header[:4])
+		chunkLen := int64(binary.LittleEndian.Uint32(header[4:]))
+		off += 8
+
+		switch id {
+		case "fmt ":
+			b, err := readSection(r, off, min(chunkLen, 16))
+			if err != nil || len(b) < 12 {
+				return tags, errors.New("invalid WAV fmt chunk")
+			}
+			byteRate = int64(binary.LittleEndian.Uint32(b[8:]))
+		case "data":
+			dataLen = min(chunkLen, size-off)
+		case "LIST":
+			b, err := readSection(r, off, chunkLen)
+			if err == nil && bytes.HasPrefix(b, []byte("INFO")) {
+				b = b[4:]
+				for len(b) >= 8 {
+					subID := string(b[:4])
+					subLen := int64(binary.LittleEndian.Uint32(b[4:]))
+					if 8+subLen > int64(len(b)) {
+						break
+					}
+					val := trimText(string(b[8 : 8+subLen]))
+					switch subID {
+					case "INAM":
+						tags.Title = val
+					case "IART":
+						tags.Artist = val
+					case "IPRD":
+						tags.Album = val
+					}
+					b = b[min(8+subLen+subLen%2, int64(len(b))):]
+				}
+			}
+		}
+
+		// chunks are word aligned
+		off += chunkLen + chunkLen%2
+	}
+	if byteRate == 0 {
+		return tags, errors.New("missing WAV fmt chunk")
+	}
+	tags.Duration = int(dataLen / byteRate)
+
+	return tags, nil
+}
+
+/*
+	MP4/M4A: ISO base media boxes
+*/
+
+type mp4Box struct {
+	typ        string
+	off, size  int64 // the payload after the box header
+	headerSize int64
+}
+
+// list the child boxes in [off, end)
+func mp4Boxes(r io.ReaderAt, off, end int64) ([]mp4Box, error) {
+	boxes := []mp4Box{}
+	header := make([]byte, 16)
+	for off+8 <= end {
+		if _, err := r.ReadAt(header[:8], off); err != nil {
+			return boxes, err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			if _, err := r.ReadAt(header[8:16], off+8); err != nil {
+				return boxes, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if size < headerSize || off+size > end {
+			return boxes, fmt.Errorf("invalid mp4 box: %q", typ)
+		}
+		boxes = append(boxes, mp4Box{
+			typ:        typ,
+			off:        off + headerSize,
+			size:       size - headerSize,
+			headerSize: headerSize,
+		})
+		off += size
+	}
+	return boxes, nil
+}
+
+func findMP4Box(boxes []mp4Box, typ string) (mp4Box, bool) {
+	for _, box := range boxes {
+		if box.typ == typ {
+			return box, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+func readMP4(r io.ReaderAt, size int64) (Tags, error) {
+	tags := Tags{}
+	top, err := mp4Boxes(r, 0, size)
+	if err != nil && len(top) == 0 {
+		return tags, err
+	}
+	moov, ok := findMP4Box(top, "moov")
+	if !ok {
+		return tags, errors.New("mp4 moov box not found")
+	}
+	children, err := mp4Boxes(r, moov.off, moov.off+moov.size)
+	if err != nil {
+		return tags, err
+	}
+
+	if mvhd, ok := findMP4Box(children, "mvhd"); ok {
+		b, err := readSection(r, mvhd.off, min(mvhd.size, 32))
+		if err == nil && len(b) >= 20 {
+			var timescale, duration int64
+			if b[0] == 1 && len(b) >= 32 {
+				timescale = int64(binary.BigEndian.Uint32(b[20:]))
+				duration = int64(binary.BigEndian.Uint64(b[24:]))
+			} else {
+				timescale = int64(binary.BigEndian.Uint32(b[12:]))
+				duration = int64(binary.BigEndian.Uint32(b[16:]))
+			}
+			if timescale > 0 {
+				tags.Duration = int(duration / timescale)
+			}
+		}
+	}
+
+	// moov.udta.meta.ilst
+	udta, ok := findMP4Box(children, "udta")
+	if !ok {
+		return tags, nil
+	}
+	children, err = mp4Boxes(r, udta.off, udta.off+udta.size)
+	if err != nil {
+		return tags, nil
+	}
+	meta, ok := findMP4Box(children, "meta")
+	if !ok || meta.size < 4 {
+		return tags, nil
+	}
+	// meta is a full box, skip version and flags
+	children, err = mp4Boxes(r, meta.off+4, meta.off+meta.size)
+	if err != nil {
+		return tags, nil
+	}
+	ilst, ok := findMP4Box(children, "ilst")
+	if !ok {
+		return tags, nil
+	}
+	items, err := mp4Boxes(r, ilst.off, ilst.off+ilst.size)
+	if err != nil && len(items) == 0 {
+		return tags, nil
+	}
+	for _, item := range items {
+		var field *string
+		switch item.typ {
+		case "\xa9nam":
+			field = &tags.Title
+		case "\xa9ART":
+			field = &tags.Artist
+		case "\xa9alb":
+			field = &tags.Album
+		default:
+			continue
+		}
+		data, err := mp4Boxes(r, item.off, item.off+item.size)
+		if err != nil {
+			continue
+		}
+		if box, ok := findMP4Box(data, "data"); ok && box.size > 8 {
+			// type indicator and locale
+			b, err := readSection(r, box.off+8, box.size-8)
+			if err == nil {
+				*field = trimText(string(b))
+			}
+		}
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,189 @@
+package playlistio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	FORMAT_JSON Format = "json"
+	FORMAT_M3U  Format = "m3u"
+	FORMAT_TXT  Format = "txt" // one url per line
+
+	M3U_HEADER = "#EXTM3U"
+	M3U_EXTINF = "#EXTINF:"
+
+	// upper bound of the items of an imported playlist
+	MAX_ITEMS = 200
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown playlist format")
+	ErrTooManyItems  = fmt.Errorf("playlist has more than %v items", MAX_ITEMS)
+)
+
+type ItemStatus string
+
+const (
+	ITEM_PLAYED  ItemStatus = "played"
+	ITEM_PLAYING ItemStatus = "playing"
+	ITEM_QUEUED  ItemStatus = "queued"
+)
+
+// an entry of an exported playlist, only URL is required on import
+type Item struct {
+	URL      string
+	Title    string     `json:",omitempty"`
+	Uploader string     `json:",omitempty"`
+	Duration int        `json:",omitempty"`
+	Status   ItemStatus `json:",omitempty"`
+}
+
+func ParseFormat(s string) (Format, bool) {
+	switch Format(strings.ToLower(s)) {
+	case FORMAT_JSON:
+		return FORMAT_JSON, true
+	case FORMAT_M3U, "m3u8":
+		return FORMAT_M3U, true
+	case FORMAT_TXT, "url", "urls":
+		return FORMAT_TXT, true
+	}
+	return "", false
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FORMAT_JSON:
+		return "application/json"
+	case FORMAT_M3U:
+		return "audio/x-mpegurl"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Detect guesses the format from the content
+func Detect(data []byte) Format {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return FORMAT_JSON
+	case bytes.HasPrefix(trimmed, []byte(M3U_HEADER)):
+		return FORMAT_M3U
+	default:
+		return FORMAT_TXT
+	}
+}
+
+func Encode(w io.Writer, format Format, items []Item) error {
+	switch format {
+	case FORMAT_JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+
+	case FORMAT_M3U:
+		bw := bufio.NewWriter(w)
+		fmt.Fprintln(bw, M3U_HEADER)
+		for _, item := range items {
+			title := item.Title
+			if item.Uploader != "" {
+				title = item.Uploader + " - " + title
+			}
+			duration := item.Duration
+			if duration <= 0 {
+				duration = -1
+			}
+			fmt.Fprintf(bw, "%v%v,%v\n", M3U_EXTINF, duration, oneLine(title))
+			fmt.Fprintln(bw, oneLine(item.URL))
+		}
+		return bw.Flush()
+
+	case FORMAT_TXT:
+		bw := bufio.NewWriter(w)
+		for _, item := range items {
+			fmt.Fprintln(bw, oneLine(item.URL))
+		}
+		return bw.Flush()
+	}
+
+	return ErrUnknownFormat
+}
+
+func Decode(data []byte, format Format) ([]Item, error) {
+	items := []Item{}
+	switch format {
+	case FORMAT_JSON:
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, fmt.Errorf("json unmarshal error, err: %v", err)
+		}
+		filtered := items[:0]
+		for _, item := range items {
+			item.URL = strings.TrimSpace(item.URL)
+			if item.URL != "" {
+				filtered = append(filtered, item)
+			}
+		}
+		items = filtered
+
+	case FORMAT_M3U, FORMAT_TXT:
+		var extinf *Item
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "":
+			case strings.HasPrefix(line, M3U_EXTINF):
+				extinf = parseExtinf(line)
+			case strings.HasPrefix(line, "#"):
+			default:
+				item := Item{URL: line}
+				if extinf != nil {
+					item.Title = extinf.Title
+					item.Duration = extinf.Duration
+					extinf = nil
+				}
+				items = append(items, item)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	if len(items) > MAX_ITEMS {
+		return nil, ErrTooManyItems
+	}
+	return items, nil
+}
+
+// "#EXTINF:<duration>,<title>"
+func parseExtinf(line string) *Item {
+	duration, title, _ := strings.Cut(strings.TrimPrefix(line, M3U_EXTINF), ",")
+	// attributes may follow the duration, e.g. `#EXTINF:-1 tvg-id="",title`
+	duration, _, _ = strings.Cut(duration, " ")
+	item := &Item{Title: strings.TrimSpace(title)}
+	if d, err := strconv.ParseFloat(duration, 64); err == nil && d > 0 {
+		item.Duration = int(d)
+	}
+	return item
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
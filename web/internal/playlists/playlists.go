@@ -0,0 +1,272 @@
+package playlists
+
+import (
+	"errors"
+	"fmt"
+	"main/internal/playlistio"
+	"main/internal/store"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MAX_PLAYLISTS_PER_USER = 50
+	MAX_NAME_LEN           = 100
+
+	// name of the store document
+	storeDocument = "playlists"
+)
+
+var (
+	ErrNotFound  = errors.New("playlist not found")
+	ErrNameTaken = errors.New("playlist name is taken")
+	ErrTooMany   = fmt.Errorf("user has more than %v playlists", MAX_PLAYLISTS_PER_USER)
+	ErrName      = fmt.Errorf("playlist name should have 1 to %v characters", MAX_NAME_LEN)
+
+	Default = New(store.Default)
+)
+
+// a named playlist owned by a user
+type Playlist struct {
+	ID      string
+	Owner   uuid.UUID `json:"-"`
+	Name    string
+	Items   []playlistio.Item
+	Created int64 // unix milli
+	Updated int64
+}
+
+// summary of a playlist without the items
+type Summary struct {
+	ID      string
+	Name    string
+	Size    int
+	Updated int64
+}
+
+// Manager keeps the playlists of every user in memory and persists them to the store on change
+type Manager struct {
+	sync.RWMutex
+	store     *store.Store
+	playlists map[uuid.UUID][]*Playlist // owner -> playlists
+}
+
+// the document layout, owner is kept in the document but hidden in the api
+type document struct {
+	Owner uuid.UUID
+	Playlist
+}
+
+func New(s *store.Store) *Manager {
+	m := &Manager{
+		store:     s,
+		playlists: make(map[uuid.UUID][]*Playlist),
+	}
+	docs := []document{}
+	if err := s.Load(storeDocument, &docs); err != nil {
+		log.Error().Err(err).Msg("[playlists] failed to load saved playlists")
+	}
+	for _, doc := range docs {
+		playlist := doc.Playlist
+		playlist.Owner = doc.Owner
+		m.playlists[doc.Owner] = append(m.playlists[doc.Owner], &playlist)
+	}
+
+	return m
+}
+
+// must be called with the lock held
+func (m *Manager) persist() error {
+	docs := []document{}
+	for owner, playlists := range m.playlists {
+		for _, playlist := range playlists {
+			docs = append(docs, document{Owner: owner, Playlist: *playlist})
+		}
+	}
+	if err := m.store.Save(storeDocument, docs); err != nil {
+		log.Error().Err(err).Msg("[playlists] failed to persist saved playlists")
+		return err
+	}
+	return nil
+}
+
+func validName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MAX_NAME_LEN {
+		return "", ErrName
+	}
+	return name, nil
+}
+
+func validItems(items []playlistio.Item) ([]playlistio.Item, error) {
+	if len(items) > playlistio.MAX_ITEMS {
+		return nil, playlistio.ErrTooManyItems
+	}
+	ret := make([]playlistio.Item, 0, len(items))
+	for _, item := range items {
+		item.URL = strings.TrimSpace(item.URL)
+		if item.URL == "" {
+			continue
+		}
+		// the status of an exported item is meaningless in a saved playlist
+		item.Status = ""
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+// must be called with the lock held
+func (m *Manager) find(owner uuid.UUID, id string) (int, *Playlist) {
+	for i, playlist := range m.playlists[owner] {
+		if playlist.ID == id {
+			return i, playlist
+		}
+	}
+	return -1, nil
+}
+
+// must be called with the lock held
+func (m *Manager) nameTaken(owner uuid.UUID, name string, except string) bool {
+	for _, playlist := range m.playlists[owner] {
+		if playlist.ID != except && strings.EqualFold(playlist.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) List(owner uuid.UUID) []Summary {
+	m.RLock()
+	defer m.RUnlock()
+
+	ret := []Summary{}
+	for _, playlist := range m.playlists[owner] {
+		summary := Summary{
+			ID:      playlist.ID,
+			Name:    playlist.Name,
+			Size:    len(playlist.Items),
+			Updated: playlist.Updated,
+		}
+		ret = append(ret, summary)
+	}
+	return ret
+}
+
+func (m *Manager) Get(owner uuid.UUID, id string) (Playlist, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	_, playlist := m.find(owner, id)
+	if playlist == nil {
+		return Playlist{}, ErrNotFound
+	}
+	ret := *playlist
+	ret.Items = slices.Clone(playlist.Items)
+	return ret, nil
+}
+
+func (m *Manager) Create(owner uuid.UUID, name string, items []playlistio.Item) (Playlist, error) {
+	name, err := validName(name)
+	if err != nil {
+		return Playlist{}, err
+	}
+	items, err = validItems(items)
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if len(m.playlists[owner]) >= MAX_PLAYLISTS_PER_USER {
+		return Playlist{}, ErrTooMany
+	}
+	if m.nameTaken(owner, name, "") {
+		return Playlist{}, ErrNameTaken
+	}
+	now := time.Now().UnixMilli()
+	playlist := &Playlist{
+		ID:      uuid.NewString(),
+		Owner:   owner,
+		Name:    name,
+		Items:   items,
+		Created: now,
+		Updated: now,
+	}
+	m.playlists[owner] = append(m.playlists[owner], playlist)
+	if err := m.persist(); err != nil {
+		m.playlists[owner] = m.playlists[owner][:len(m.playlists[owner])-1]
+		return Playlist{}, err
+	}
+
+	return *playlist, nil
+}
+
+// Update replaces the name and the items of the playlist, nil fields are unchanged
+func (m *Manager) Update(owner uuid.UUID, id string, name *string, items []playlistio.Item) (Playlist, error) {
+	var err error
+	if name != nil {
+		var validated string
+		if validated, err = validName(*name); err != nil {
+			return Playlist{}, err
+		}
+		name = &validated
+	}
+	if items != nil {
+		if items, err = validItems(items); err != nil {
+			return Playlist{}, err
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	_, playlist := m.find(owner, id)
+	if playlist == nil {
+		return Playlist{}, ErrNotFound
+	}
+	if name != nil && m.nameTaken(owner, *name, id) {
+		return Playlist{}, ErrNameTaken
+	}
+	old := *playlist
+	if name != nil {
+		playlist.Name = *name
+	}
+	if items != nil {
+		playlist.Items = items
+	}
+	playlist.Updated = time.Now().UnixMilli()
+	if err := m.persist(); err != nil {
+		*playlist = old
+		return Playlist{}, err
+	}
+
+	return *playlist, nil
+}
+
+func (m *Manager) Delete(owner uuid.UUID, id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	i, playlist := m.find(owner, id)
+	if playlist == nil {
+		return ErrNotFound
+	}
+	old := m.playlists[owner]
+	m.playlists[owner] = slices.Delete(slices.Clone(old), i, i+1)
+	if len(m.playlists[owner]) == 0 {
+		delete(m.playlists, owner)
+	}
+	if err := m.persist(); err != nil {
+		m.playlists[owner] = old
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"main/internal/auth"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+type AccessPolicy string
+
+const (
+	// anyone with the rid can join
+	ACCESS_OPEN AccessPolicy = "open"
+	// the room password is required to create a session
+	ACCESS_PASSWORD AccessPolicy = "password"
+	// the host accepts or denies every client before it is registered
+	ACCESS_APPROVAL AccessPolicy = "approval"
+)
+
+const (
+	TIMEOUT_JOIN_REQUEST = 60 * time.Second
+
+	// upper bound of the pending join requests of a room
+	MAX_JOIN_REQUESTS = 20
+
+	// a remote address has PASSWORD_RATE_BURST password attempts to a room at once, then one attempt every PASSWORD_RATE_INTERVAL
+	PASSWORD_RATE_BURST    = 3
+	PASSWORD_RATE_INTERVAL = 20 * time.Second
+	// the attempts of a remote address, across the rooms
+	PASSWORD_ADDR_RATE_BURST    = 5
+	PASSWORD_ADDR_RATE_INTERVAL = 10 * time.Second
+)
+
+type JoinStatus string
+
+const (
+	JOIN_PENDING  JoinStatus = "pending"
+	JOIN_ACCEPTED JoinStatus = "accepted"
+	JOIN_DENIED   JoinStatus = "denied"
+	JOIN_EXPIRED  JoinStatus = "expired"
+)
+
+var (
+	ErrJoinRequestNotFound = errors.New("join request not found")
+	ErrJoinRequestExists   = errors.New("join request exists already")
+	ErrTooManyJoinRequests = fmt.Errorf("room has more than %v pending join requests", MAX_JOIN_REQUESTS)
+	ErrPasswordRateLimited = errors.New("too many password attempts")
+
+	// the password attempts per remote address, shared by the rooms
+	passwordAttempts rateLimiters
+)
+
+// a client waiting for the approval of the host, sent to the hosts and the client
+type JoinRequest struct {
+	UID      string
+	Username string
+	Status   JoinStatus
+}
+
+type pendingJoin struct {
+	client *Client
+	answer chan bool
+}
+
+// Access is the access policy of a room, the policy is fixed when the room is created
+type Access struct {
+	Policy       AccessPolicy
+	passwordHash string
+	attempts     rateLimiters // the password attempts to the room per remote address
+
+	sync.Mutex
+	pending map[uuid.UUID]*pendingJoin // uid -> request
+}
+
+func ParseAccessPolicy(s string) (AccessPolicy, bool) {
+	switch AccessPolicy(s) {
+	case "", ACCESS_OPEN:
+		return ACCESS_OPEN, true
+	case ACCESS_PASSWORD, ACCESS_APPROVAL:
+		return AccessPolicy(s), true
+	}
+	return "", false
+}
+
+// the password is required by ACCESS_PASSWORD only, it is kept hashed
+func NewAccess(policy AccessPolicy, password string) (*Access, error) {
+	access := &Access{
+		Policy:  policy,
+		pending: make(map[uuid.UUID]*pendingJoin),
+	}
+	if policy == ACCESS_PASSWORD {
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		access.passwordHash = hash
+	}
+	return access, nil
+}
+
+// always true if the room is not password protected
+func (access *Access) VerifyPassword(password string) bool {
+	if access.Policy != ACCESS_PASSWORD {
+		return true
+	}
+	return auth.VerifyPassword(password, access.passwordHash)
+}
+
+// AllowPassword consumes a password attempt of the remote address, to the room and across the rooms,
+// it is checked before VerifyPassword as the password hash is slow on purpose
+func (access *Access) AllowPassword(addr string) bool {
+	if !access.attempts.Allow(addr, PASSWORD_RATE_BURST, PASSWORD_RATE_INTERVAL) {
+		return false
+	}
+	return passwordAttempts.Allow(addr, PASSWORD_ADDR_RATE_BURST, PASSWORD_ADDR_RATE_INTERVAL)
+}
+
+// the pending join requests, ordered by nothing
+func (access *Access) Requests() []JoinRequest {
+	access.Lock()
+	defer access.Unlock()
+
+	ret := make([]JoinRequest, 0, len(access.pending))
+	for _, pending := range access.pending {
+		ret = append(ret, JoinRequest{
+			UID:      pending.client.ID.String(),
+			Username: pending.client.Name,
+			Status:   JOIN_PENDING,
+		})
+	}
+	return ret
+}
+
+func (access *Access) request(client *Client) (*pendingJoin, error) {
+	access.Lock()
+	defer access.Unlock()
+
+	if _, ok := access.pending[client.ID]; ok {
+		return nil, ErrJoinRequestExists
+	}
+	if len(access.pending) >= MAX_JOIN_REQUESTS {
+		return nil, ErrTooManyJoinRequests
+	}
+	pending := &pendingJoin{
+		client: client,
+		answer: make(chan bool, 1),
+	}
+	access.pending[client.ID] = pending
+	return pending, nil
+}
+
+// Answer accepts or denies the join request of the uid
+func (access *Access) Answer(uid uuid.UUID, accept bool) error {
+	access.Lock()
+	defer access.Unlock()
+
+	pending, ok := access.pending[uid]
+	if !ok {
+		return ErrJoinRequestNotFound
+	}
+	delete(access.pending, uid)
+	pending.answer <- accept
+	return nil
+}
+
+func (access *Access) cancel(pending *pendingJoin) {
+	access.Lock()
+	defer access.Unlock()
+
+	if access.pending[pending.client.ID] == pending {
+		delete(access.pending, pending.client.ID)
+	}
+}
+
+// write the status to the connection of the client, it is not registered in the hub yet
+func (client *Client) writeJoinStatus(status JoinStatus) {
+	msg := DirectMessage[JoinRequest]{
+		MsgType: MSG_EVENT_ROOM,
+		To:      client.ID,
+		Data: JoinRequest{
+			UID:      client.ID.String(),
+			Username: client.Name,
+			Status:   status,
+		},
+	}
+	msgJson, err := msg.Json()
+	if err != nil {
+		log.Error().Err(err).Msg("[hub] join status json encode error")
+		return
+	}
+	client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	client.Conn.WriteMessage(websocket.TextMessage, msgJson)
+}
+
+// the join request is sent to every host
+func (h *Hub) hostsJoinRequest(client *Client, status JoinStatus) {
+	msg := BroadcastMessage[JoinRequest]{
+		MsgType: MSG_EVENT_ROOM,
+		UID:     uuid.Nil.String(),
+		Data: JoinRequest{
+			UID:      client.ID.String(),
+			Username: client.Name,
+			Status:   status,
+		},
+	}
+	h.HostsMsg(&msg)
+}
+
+// AwaitApproval sends the join request of the client to the hosts, and blocks until it is answered.
+// The connection is closed unless the request is accepted, the client should be registered by the caller then
+func (h *Hub) AwaitApproval(client *Client) bool {
+	status := JOIN_DENIED
+	defer func() {
+		if status == JOIN_ACCEPTED {
+			return
+		}
+		reason := fmt.Sprintf("join request %v", status)
+		client.Conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason),
+			time.Now().Add(writeWait),
+		)
+		client.Conn.Close()
+		log.Info().
+			Str("uid", client.ID.String()).
+			Str("rid", h.B64ID()).
+			Str("status", string(status)).
+			Msg("[hub] join request closed")
+	}()
+
+	pending, err := h.Access.request(client)
+	if err != nil {
+		log.Info().Err(err).Str("uid", client.ID.String()).Msg("[hub] join request refused")
+		return false
+	}
+	client.writeJoinStatus(JOIN_PENDING)
+	h.hostsJoinRequest(client, JOIN_PENDING)
+
+	select {
+	case accept := <-pending.answer:
+		if accept {
+			status = JOIN_ACCEPTED
+			client.writeJoinStatus(status)
+			return true
+		}
+		return false
+	case <-time.After(TIMEOUT_JOIN_REQUEST):
+		status = JOIN_EXPIRED
+	case <-h.Context().Done():
+		status = JOIN_EXPIRED
+	}
+	h.Access.cancel(pending)
+	h.hostsJoinRequest(client, status)
+	return false
+}
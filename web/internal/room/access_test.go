@@ -0,0 +1,35 @@
+package room
+
+import "testing"
+
+func TestAllowPasswordPerAddress(t *testing.T) {
+	passwordAttempts = rateLimiters{}
+	access := &Access{Policy: ACCESS_PASSWORD}
+	for i := 0; i < PASSWORD_RATE_BURST; i++ {
+		if !access.AllowPassword("192.0.2.1") {
+			t.Fatalf("attempt %v is refused within the burst", i)
+		}
+	}
+	if access.AllowPassword("192.0.2.1") {
+		t.Fatal("the attempt is allowed after the burst of the room")
+	}
+
+	// another address is not locked out of the room
+	if !access.AllowPassword("192.0.2.2") {
+		t.Fatal("the attempt of another address is refused")
+	}
+}
+
+func TestAllowPasswordAcrossRooms(t *testing.T) {
+	passwordAttempts = rateLimiters{}
+	allowed := 0
+	for i := 0; i < PASSWORD_ADDR_RATE_BURST+1; i++ {
+		// a new room per attempt, only the attempts of the address are limited
+		if (&Access{Policy: ACCESS_PASSWORD}).AllowPassword("192.0.2.3") {
+			allowed++
+		}
+	}
+	if allowed != PASSWORD_ADDR_RATE_BURST {
+		t.Fatalf("%v attempts are allowed across the rooms, want %v", allowed, PASSWORD_ADDR_RATE_BURST)
+	}
+}
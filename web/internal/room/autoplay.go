@@ -0,0 +1,148 @@
+package room
+
+import (
+	"context"
+	"main/internal/source"
+	"main/internal/ytdlp"
+	"math/rand/v2"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// number of related tracks requested from the source
+	AUTOPLAY_RELATED_RESULTS = 10
+	// recently played tracks are not picked again
+	AUTOPLAY_RECENT_SIZE = 20
+)
+
+// autoplay picks a track in the background when the playlist runs dry and the room has enabled autoplay.
+// The related tracks of the last played node are preferred,
+// the room history is shuffled if the source has no related tracks.
+// The picked node is enqueued with fetchLock held, then the player is signaled as if a client added it.
+// The ADD event is broadcast once fetchLock is released.
+// Must be called with fetchLock held
+func (mp *MusicPlayer) autoplay(mpctx context.Context) {
+	hub := mp.hub
+	if hub == nil || mp.autoplaying || !mp.Settings().Autoplay || mp.Playlist.Size() > 0 {
+		return
+	}
+
+	history := hub.History.List()
+	recent := make(map[string]struct{})
+	for i := len(history) - 1; i >= 0 && len(history)-i <= AUTOPLAY_RECENT_SIZE; i-- {
+		recent[ytdlp.CanonicalURL(history[i].URL)] = struct{}{}
+	}
+	seed := ""
+	if mp.CurNode != nil {
+		seed = mp.CurNode.URL
+		recent[ytdlp.CanonicalURL(seed)] = struct{}{}
+	} else if len(history) > 0 {
+		seed = history[len(history)-1].URL
+	}
+	if seed == "" {
+		return
+	}
+
+	mp.autoplaying = true
+	go func() {
+		// the related search is slow, the player is not blocked while picking
+		node := mp.pickRelated(mpctx, seed, recent)
+		if node == nil {
+			node = pickHistory(history, recent)
+		}
+
+		mp.fetchLock.Lock()
+		mp.autoplaying = false
+		playing := mp.CurNode != nil
+		enqueued := mp.enqueueAutoplay(node, seed)
+		mp.unlockFetch()
+		if !enqueued {
+			return
+		}
+
+		// start the node if nothing is playing, otherwise download it ahead
+		signal := mp.AddedSong
+		if playing {
+			signal = mp.Preload
+		}
+		select {
+		case <-mpctx.Done():
+		case signal <- struct{}{}:
+		}
+	}()
+}
+
+// enqueue the picked node if the playlist is still empty, must be called with fetchLock held
+func (mp *MusicPlayer) enqueueAutoplay(node *MusicInfo, seed string) bool {
+	if node == nil {
+		log.Debug().Str("seed", seed).Msg("[mp] autoplay found no candidate")
+		return false
+	}
+	if !mp.Settings().Autoplay || mp.Playlist.Size() > 0 {
+		// a client has added a node or disabled autoplay while picking
+		return false
+	}
+	if err := mp.Playlist.Enqueue(node); err != nil {
+		log.Error().Err(err).Msg("[mp] autoplay enqueue error")
+		return false
+	}
+
+	wsInfoJson := WSInfoJson{
+		ID:        node.ID,
+		Cmd:       INFOJSON_CMD_ADD,
+		AutoAdded: true,
+		InfoJson:  node.InfoJson,
+	}
+	msg := BroadcastMessage[WSInfoJson]{
+		MsgType: MSG_EVENT_PLAYLIST,
+		UID:     uuid.Nil.String(),
+		Data:    wsInfoJson,
+	}
+	mp.broadcastLater(&msg)
+
+	return true
+}
+
+func (mp *MusicPlayer) pickRelated(mpctx context.Context, seed string, recent map[string]struct{}) *MusicInfo {
+	results, err := source.Related(mpctx, seed, AUTOPLAY_RELATED_RESULTS)
+	if err != nil {
+		log.Debug().Err(err).Str("seed", seed).Msg("[mp] autoplay related tracks not found")
+		return nil
+	}
+	for _, result := range results {
+		if _, ok := recent[ytdlp.CanonicalURL(result.URL)]; ok {
+			continue
+		}
+		return &MusicInfo{
+			URL:       result.URL,
+			InfoJson:  result.InfoJson,
+			AutoAdded: true,
+		}
+	}
+	return nil
+}
+
+// pick a random track from the history, the recently played tracks are skipped if possible
+func pickHistory(history []HistoryEntry, recent map[string]struct{}) *MusicInfo {
+	if len(history) == 0 {
+		return nil
+	}
+	candidates := []HistoryEntry{}
+	for _, entry := range history {
+		if _, ok := recent[ytdlp.CanonicalURL(entry.URL)]; !ok {
+			candidates = append(candidates, entry)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = history
+	}
+	entry := candidates[rand.IntN(len(candidates))]
+
+	return &MusicInfo{
+		URL:       entry.URL,
+		InfoJson:  entry.InfoJson,
+		AutoAdded: true,
+	}
+}
@@ -0,0 +1,175 @@
+package room
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	CHAT_HISTORY_SIZE = 100
+	// in runes
+	MAX_CHAT_LENGTH = 500
+
+	// a client can send CHAT_RATE_BURST messages at once, then one message every CHAT_RATE_INTERVAL
+	CHAT_RATE_BURST    = 5
+	CHAT_RATE_INTERVAL = 2 * time.Second
+)
+
+var (
+	ErrChatEmpty       = errors.New("chat message is empty")
+	ErrChatTooLong     = errors.New("chat message is too long")
+	ErrChatRateLimited = errors.New("too many chat messages")
+)
+
+type ChatCmd string
+
+const (
+	CHAT_CMD_ADD     ChatCmd = "ADD"
+	CHAT_CMD_DELETE  ChatCmd = "DELETE"
+	CHAT_CMD_HISTORY ChatCmd = "HISTORY" // sent to the joining client
+)
+
+type ChatMessage struct {
+	ID        int
+	UID       string
+	Username  string
+	Text      string
+	UnixMilli int64
+}
+
+type ChatEvent struct {
+	Cmd     ChatCmd
+	ID      int           // the deleted message
+	Message *ChatMessage  `json:",omitempty"`
+	History []ChatMessage `json:",omitempty"`
+}
+
+// Chat keeps the recent messages of a room, the oldest message is dropped when it is full
+type Chat struct {
+	sync.RWMutex
+	messages []ChatMessage
+	autoID   autoIncID
+}
+
+func NewChat() *Chat {
+	return &Chat{
+		messages: make([]ChatMessage, 0, CHAT_HISTORY_SIZE),
+		autoID:   autoIncID{id: -1},
+	}
+}
+
+// trim the text and check the length
+func ValidateChat(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || !utf8.ValidString(text) {
+		return "", ErrChatEmpty
+	}
+	if utf8.RuneCountInString(text) > MAX_CHAT_LENGTH {
+		return "", ErrChatTooLong
+	}
+	return text, nil
+}
+
+func (chat *Chat) Add(client *Client, text string) ChatMessage {
+	chat.Lock()
+	defer chat.Unlock()
+
+	msg := ChatMessage{
+		ID:        chat.autoID.ID(),
+		UID:       client.ID.String(),
+		Username:  client.Name,
+		Text:      text,
+		UnixMilli: time.Now().UnixMilli(),
+	}
+	if len(chat.messages) >= CHAT_HISTORY_SIZE {
+		chat.messages = append(chat.messages[:0], chat.messages[1:]...)
+	}
+	chat.messages = append(chat.messages, msg)
+
+	return msg
+}
+
+func (chat *Chat) Delete(id int) bool {
+	chat.Lock()
+	defer chat.Unlock()
+
+	for i, msg := range chat.messages {
+		if msg.ID == id {
+			chat.messages = append(chat.messages[:i], chat.messages[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// returns the messages from the oldest to the latest
+func (chat *Chat) List() []ChatMessage {
+	chat.RLock()
+	defer chat.RUnlock()
+
+	ret := make([]ChatMessage, len(chat.messages))
+	copy(ret, chat.messages)
+	return ret
+}
+
+// PostChat validates the text and broadcasts it as the client, the message is kept in the history
+func (h *Hub) PostChat(client *Client, text string) (ChatMessage, error) {
+	text, err := ValidateChat(text)
+	if err != nil {
+		return ChatMessage{}, err
+	}
+	if !client.chatLimit.Allow(CHAT_RATE_BURST, CHAT_RATE_INTERVAL) {
+		return ChatMessage{}, ErrChatRateLimited
+	}
+
+	chatMsg := h.Chat.Add(client, text)
+	msg := BroadcastMessage[ChatEvent]{
+		MsgType:  MSG_EVENT_CHAT,
+		UID:      client.ID.String(),
+		Username: client.Name,
+		Data:     ChatEvent{Cmd: CHAT_CMD_ADD, ID: chatMsg.ID, Message: &chatMsg},
+	}
+	go h.BroadcastMsg(&msg)
+
+	return chatMsg, nil
+}
+
+// DeleteChat removes the message from the history, the clients are notified to remove it
+func (h *Hub) DeleteChat(client *Client, id int) bool {
+	if !h.Chat.Delete(id) {
+		return false
+	}
+	msg := BroadcastMessage[ChatEvent]{
+		MsgType:  MSG_EVENT_CHAT,
+		UID:      client.ID.String(),
+		Username: client.Name,
+		Data:     ChatEvent{Cmd: CHAT_CMD_DELETE, ID: id},
+	}
+	go h.BroadcastMsg(&msg)
+
+	return true
+}
+
+// called in the hub loop
+func (h *Hub) sendChatHistory(client *Client) {
+	history := h.Chat.List()
+	if len(history) == 0 {
+		return
+	}
+	msg := DirectMessage[ChatEvent]{
+		MsgType: MSG_EVENT_CHAT,
+		To:      client.ID,
+		Data:    ChatEvent{Cmd: CHAT_CMD_HISTORY, History: history},
+	}
+	msgJson, err := msg.Json()
+	if err != nil {
+		log.Error().Err(err).Msg("[hub] chat history json encode error")
+		return
+	}
+	h.send(client, msgJson, DELIVERY_ORDERED, "")
+}
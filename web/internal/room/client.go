@@ -2,6 +2,7 @@ package room
 
 import (
 	"encoding/json"
+	"main/internal/auth"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +15,9 @@ const (
 	READSIZE  = 1024 * 8
 	WRITESIZE = 1024 * 8
 
+	// buffer size of Client.Send
+	SEND_BUFFER_SIZE = 1024
+
 	// ping pong message time
 	writeWait = 10 * time.Second
 	pongWait  = 60 * time.Second
@@ -29,6 +33,12 @@ var (
 	}
 )
 
+const (
+	PERMISSION_GUEST   = 1
+	PERMISSION_TRUSTED = 3
+	PERMISSION_HOST    = 7
+)
+
 /*
 permission: allowed values are 1,3,7
 1 = guest
@@ -42,31 +52,66 @@ type Client struct {
 	Token         uuid.UUID
 	Name          string
 	Permission    int
+	Verified      bool          // the uid is bound to the user cookie or the account
+	Session       *auth.Session // nil if the client has not logged in
 	Send          chan []byte
 	JoinUnixMilli int64
+
+	chatLimit  rateLimiter
+	reactLimit rateLimiter
+
+	// sent with the close message when the hub closes Send
+	closeReason string
+
+	// owned by the hub loop
+	suspended bool          // the connection is lost, the client can resume within the grace period
+	connGen   int           // incremented on every connection of the client
+	replay    *replayBuffer // the messages sent to the client
+	outbox    outbox        // the messages waiting for room in Send
+}
+
+// permissions are bit flags, a higher permission contains the lower ones
+// the permission is changed in the hub loop with ClientMapMutex held,
+// it must not be called with ClientMapMutex held
+func (c *Client) Allowed(permission int) bool {
+	return c.CurrentPermission()&permission == permission
+}
+
+// returns the permission read under ClientMapMutex, it must not be called with ClientMapMutex held
+func (c *Client) CurrentPermission() int {
+	ClientMapMutex.RLock()
+	defer ClientMapMutex.RUnlock()
+
+	return c.Permission
 }
 
+// the connection is replaced when the client resumes, Read() and Write() keep the one they are started with
 func (c *Client) Read() {
+	conn := c.Conn
+	gen := c.connGen
+	leave := false
 	defer func() {
-		c.Hub.Unregister <- c
-		c.Conn.Close()
+		c.Hub.disconnect(c, gen, leave)
+		conn.Close()
 		log.Debug().
 			Str("uid", c.ID.String()).
 			Str("rid", c.Hub.B64ID()).
 			Msg("[ws] client defer write")
 	}()
 
-	c.Conn.SetReadLimit(READSIZE)
-	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.Conn.SetPongHandler(func(string) error { c.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	conn.SetReadLimit(READSIZE)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
 	for {
-		_, msgRead, err := c.Conn.ReadMessage()
+		_, msgRead, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Error().Err(err).Str("uid", c.ID.String()).Msg("[ws] Client unexpected read error")
 			}
 			log.Warn().Err(err).Str("uid", c.ID.String()).Msg("[ws] Client read error")
+			// the client closed the connection on purpose, otherwise it could resume
+			leave = websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway)
 			return
 		}
 		// msg = bytes.TrimSpace(bytes.Replace(msg, "\n", " ", -1))
@@ -109,10 +154,12 @@ func (c *Client) Read() {
 }
 
 func (c *Client) Write() {
+	conn := c.Conn
+	send := c.Send
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
-		c.Conn.Close()
+		conn.Close()
 		log.Debug().
 			Str("uid", c.ID.String()).
 			Str("rid", c.Hub.B64ID()).
@@ -121,15 +168,19 @@ func (c *Client) Write() {
 
 	for {
 		select {
-		case msg, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case msg, ok := <-send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// channel is closed by the hub
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMsg := []byte{}
+				if c.closeReason != "" {
+					closeMsg = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, c.closeReason)
+				}
+				conn.WriteMessage(websocket.CloseMessage, closeMsg)
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
+			w, err := conn.NextWriter(websocket.TextMessage)
 			if err != nil {
 				log.Error().Err(err).Str("uid", c.ID.String()).Msg("[ws] Client NextWriter error")
 				return
@@ -141,8 +192,8 @@ func (c *Client) Write() {
 			}
 		case <-ticker.C:
 			// ping message
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				log.Warn().Err(err).Str("uid", c.ID.String()).Msg("[ws] Client ping error")
 				return
 			}
@@ -155,8 +206,8 @@ func (c *Client) SignalMPAdd() {
 	c.Hub.Player.AddedSong <- struct{}{}
 }
 
-func (c *Client) SignalMPNext() {
-	c.Hub.Player.NextSong <- struct{}{}
+func (c *Client) SignalMPNext(skipped bool) {
+	c.Hub.Player.NextSong <- skipped
 }
 
 func (c *Client) SignalMPPreload() {
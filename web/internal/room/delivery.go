@@ -0,0 +1,184 @@
+package room
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type DeliveryClass int
+
+const (
+	// delivered in order, queued while Client.Send is full
+	DELIVERY_ORDERED DeliveryClass = iota
+	// only the latest message of the same key is kept while Client.Send is full
+	DELIVERY_LATEST
+	// dropped while Client.Send is full
+	DELIVERY_DROP
+)
+
+const (
+	// upper bound of the queued messages of a client
+	MAX_OUTBOX_SIZE = 1024
+	// the client is disconnected if its messages are waiting longer than this
+	SLOW_CONSUMER_TIMEOUT = 10 * time.Second
+	// interval of the hub loop to retry the waiting messages
+	FLUSH_INTERVAL = 250 * time.Millisecond
+
+	CLOSE_REASON_SLOW_CONSUMER = "slow consumer"
+)
+
+// the messages waiting for room in Client.Send, owned by the hub loop
+type outbox struct {
+	queue      [][]byte
+	latest     map[string][]byte
+	latestKeys []string  // keys of latest in the order of arrival
+	slowSince  time.Time // zero if nothing is waiting
+}
+
+func (ob *outbox) empty() bool {
+	return len(ob.queue) == 0 && len(ob.latestKeys) == 0
+}
+
+func (ob *outbox) size() int {
+	return len(ob.queue) + len(ob.latestKeys)
+}
+
+func (ob *outbox) setLatest(key string, msgJson []byte) {
+	if ob.latest == nil {
+		ob.latest = make(map[string][]byte)
+	}
+	if _, ok := ob.latest[key]; !ok {
+		ob.latestKeys = append(ob.latestKeys, key)
+	}
+	ob.latest[key] = msgJson
+}
+
+// the waiting messages in the delivery order, the outbox is cleared
+func (ob *outbox) drain() [][]byte {
+	ret := ob.queue
+	for _, key := range ob.latestKeys {
+		ret = append(ret, ob.latest[key])
+	}
+	*ob = outbox{}
+	return ret
+}
+
+// player sync messages only matter in their latest state, debug messages can be lost.
+// The preload status is kept per node, the driver needs the status of every preloaded node
+func deliveryOf(msg WSMessage) (DeliveryClass, string) {
+	switch m := msg.(type) {
+	case *BroadcastMessage[PlayerSettings]:
+		return DELIVERY_LATEST, "settings"
+	case *DirectMessage[MPStatus]:
+		return DELIVERY_LATEST, "status:" + strconv.Itoa(m.Data.NextID)
+	case *BroadcastMessage[ReactionEvent]:
+		return DELIVERY_LATEST, "reactions"
+	}
+	if msg.DebugMode() {
+		return DELIVERY_DROP, ""
+	}
+	return DELIVERY_ORDERED, ""
+}
+
+// hand the message to the writer without blocking
+func (h *Hub) trySend(client *Client, msgJson []byte) bool {
+	select {
+	case client.Send <- msgJson:
+		client.replay.push(msgJson)
+		return true
+	default:
+		return false
+	}
+}
+
+// queue the message to the client by the delivery class,
+// it is kept for the replay while the client is suspended
+func (h *Hub) send(client *Client, msgJson []byte, class DeliveryClass, key string) {
+	if _, ok := h.Clients[client]; !ok {
+		return
+	}
+	if client.suspended {
+		client.replay.push(msgJson)
+		return
+	}
+
+	ob := &client.outbox
+	h.flush(client)
+	switch class {
+	case DELIVERY_ORDERED:
+		if len(ob.queue) > 0 || !h.trySend(client, msgJson) {
+			ob.queue = append(ob.queue, msgJson)
+		}
+	case DELIVERY_LATEST:
+		if _, ok := ob.latest[key]; ok || !h.trySend(client, msgJson) {
+			ob.setLatest(key, msgJson)
+		}
+	case DELIVERY_DROP:
+		if !h.trySend(client, msgJson) {
+			log.Debug().Str("uid", client.ID.String()).Msg("[hub] message dropped, client is busy")
+		}
+	}
+	h.checkSlow(client)
+}
+
+// move the waiting messages to the writer as long as there is room
+func (h *Hub) flush(client *Client) {
+	ob := &client.outbox
+	if ob.empty() {
+		return
+	}
+	for len(ob.queue) > 0 && h.trySend(client, ob.queue[0]) {
+		ob.queue[0] = nil
+		ob.queue = ob.queue[1:]
+	}
+	for len(ob.queue) == 0 && len(ob.latestKeys) > 0 {
+		key := ob.latestKeys[0]
+		if !h.trySend(client, ob.latest[key]) {
+			break
+		}
+		delete(ob.latest, key)
+		ob.latestKeys = ob.latestKeys[1:]
+	}
+	if ob.empty() {
+		*ob = outbox{}
+	}
+}
+
+// disconnect the client if it can not keep up
+func (h *Hub) checkSlow(client *Client) {
+	ob := &client.outbox
+	if ob.empty() {
+		return
+	}
+	now := time.Now()
+	if ob.slowSince.IsZero() {
+		ob.slowSince = now
+		return
+	}
+	if ob.size() <= MAX_OUTBOX_SIZE && now.Sub(ob.slowSince) <= SLOW_CONSUMER_TIMEOUT {
+		return
+	}
+
+	log.Warn().
+		Str("uid", client.ID.String()).
+		Str("rid", h.B64ID()).
+		Int("waiting", ob.size()).
+		Dur("slow", now.Sub(ob.slowSince)).
+		Msg("[hub] disconnect slow consumer")
+	*ob = outbox{}
+	client.closeReason = CLOSE_REASON_SLOW_CONSUMER
+	h.unregister(client)
+}
+
+// retry the waiting messages of every client, must be called in the hub loop
+func (h *Hub) flushAll() {
+	for client := range h.Clients {
+		if client.suspended || client.outbox.empty() {
+			continue
+		}
+		h.flush(client)
+		h.checkSlow(client)
+	}
+}
@@ -0,0 +1,128 @@
+package room
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// a client of a hub which is not running, Send has room for one message
+func newDeliveryClient() (*Hub, *Client) {
+	h := CreateHub(uuid.New())
+	client := &Client{
+		Hub:    h,
+		ID:     uuid.New(),
+		Send:   make(chan []byte, 1),
+		replay: newReplayBuffer(),
+	}
+	h.Clients[client] = PERMISSION_GUEST
+	return h, client
+}
+
+// receive the messages of Send, the waiting ones are flushed one by one
+func receiveAll(h *Hub, client *Client) []string {
+	ret := []string{}
+	for {
+		select {
+		case msg := <-client.Send:
+			ret = append(ret, string(msg))
+			h.flush(client)
+		default:
+			return ret
+		}
+	}
+}
+
+func checkMessages(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("messages = %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("messages = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestOutboxOrdered(t *testing.T) {
+	h, client := newDeliveryClient()
+	for _, msg := range []string{"1", "2", "3"} {
+		h.send(client, []byte(msg), DELIVERY_ORDERED, "")
+	}
+	if client.outbox.size() != 2 {
+		t.Fatalf("outbox size = %v, want 2", client.outbox.size())
+	}
+	checkMessages(t, receiveAll(h, client), "1", "2", "3")
+	if !client.outbox.empty() {
+		t.Fatal("outbox is not empty after the flush")
+	}
+}
+
+func TestOutboxLatestCoalesced(t *testing.T) {
+	h, client := newDeliveryClient()
+	h.send(client, []byte("status 1"), DELIVERY_LATEST, "status")
+	h.send(client, []byte("status 2"), DELIVERY_LATEST, "status")
+	h.send(client, []byte("settings 1"), DELIVERY_LATEST, "settings")
+	h.send(client, []byte("status 3"), DELIVERY_LATEST, "status")
+	h.send(client, []byte("settings 2"), DELIVERY_LATEST, "settings")
+
+	// only the latest message of a key is kept, in the order the keys arrived
+	checkMessages(t, receiveAll(h, client), "status 1", "status 3", "settings 2")
+}
+
+func TestOutboxLatestAfterOrdered(t *testing.T) {
+	h, client := newDeliveryClient()
+	h.send(client, []byte("chat 1"), DELIVERY_ORDERED, "")
+	h.send(client, []byte("status 1"), DELIVERY_LATEST, "status")
+	h.send(client, []byte("chat 2"), DELIVERY_ORDERED, "")
+	h.send(client, []byte("status 2"), DELIVERY_LATEST, "status")
+
+	// the latest messages wait for the ordered ones
+	checkMessages(t, receiveAll(h, client), "chat 1", "chat 2", "status 2")
+}
+
+func TestOutboxDrop(t *testing.T) {
+	h, client := newDeliveryClient()
+	h.send(client, []byte("debug 1"), DELIVERY_DROP, "")
+	h.send(client, []byte("debug 2"), DELIVERY_DROP, "")
+	if !client.outbox.empty() {
+		t.Fatal("the dropped message is queued")
+	}
+	checkMessages(t, receiveAll(h, client), "debug 1")
+}
+
+func TestOutboxSuspended(t *testing.T) {
+	h, client := newDeliveryClient()
+	client.suspended = true
+	h.send(client, []byte("1"), DELIVERY_ORDERED, "")
+	h.send(client, []byte("2"), DELIVERY_LATEST, "status")
+
+	// the messages are kept for the replay only
+	if len(client.Send) != 0 || !client.outbox.empty() {
+		t.Fatal("the message is sent to a suspended client")
+	}
+	msgs, ok := client.replay.since(0)
+	if !ok || len(msgs) != 2 {
+		t.Fatalf("replay = %v messages, %v, want 2, true", len(msgs), ok)
+	}
+}
+
+func TestDeliveryOf(t *testing.T) {
+	tests := []struct {
+		msg   WSMessage
+		class DeliveryClass
+		key   string
+	}{
+		{&BroadcastMessage[PlayerSettings]{}, DELIVERY_LATEST, "settings"},
+		{&DirectMessage[MPStatus]{Data: MPStatus{NextID: 2}}, DELIVERY_LATEST, "status:2"},
+		{&BroadcastMessage[ReactionEvent]{}, DELIVERY_LATEST, "reactions"},
+		{&BroadcastMessage[Event]{MsgType: MSG_EVENT_ROOM}, DELIVERY_ORDERED, ""},
+	}
+	for _, tt := range tests {
+		class, key := deliveryOf(tt.msg)
+		if class != tt.class || key != tt.key {
+			t.Errorf("deliveryOf(%T) = %v, %q, want %v, %q", tt.msg, class, key, tt.class, tt.key)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package room
+
+import (
+	"cmp"
+	"main/internal/ytdlp"
+	"slices"
+	"sync"
+)
+
+const (
+	HISTORY_MAX_SIZE = 100
+)
+
+// a played node
+type HistoryEntry struct {
+	ID              int
+	URL             string `json:"-"`
+	QueuedBy        string
+	QueuedByName    string
+	PlayedUnixMilli int64
+	Skipped         bool
+	AutoAdded       bool
+	Reactions       map[string]int `json:",omitempty"` // emoji -> count
+	ReactionTotal   int
+	ytdlp.InfoJson
+}
+
+// History keeps the recently played nodes of a room, the oldest entry is dropped when it is full
+type History struct {
+	sync.RWMutex
+	entries []HistoryEntry
+	autoID  autoIncID
+}
+
+func NewHistory() *History {
+	return &History{
+		entries: make([]HistoryEntry, 0, HISTORY_MAX_SIZE),
+		autoID:  autoIncID{id: -1},
+	}
+}
+
+func (history *History) Add(info *MusicInfo, playedUnixMilli int64, skipped bool, reactions map[string]int) HistoryEntry {
+	history.Lock()
+	defer history.Unlock()
+
+	entry := HistoryEntry{
+		ID:              history.autoID.ID(),
+		URL:             info.URL,
+		QueuedBy:        info.QueuedBy,
+		QueuedByName:    info.QueuedByName,
+		PlayedUnixMilli: playedUnixMilli,
+		Skipped:         skipped,
+		AutoAdded:       info.AutoAdded,
+		Reactions:       reactions,
+		InfoJson:        info.InfoJson,
+	}
+	for _, count := range reactions {
+		entry.ReactionTotal += count
+	}
+	if len(history.entries) >= HISTORY_MAX_SIZE {
+		history.entries = append(history.entries[:0], history.entries[1:]...)
+	}
+	history.entries = append(history.entries, entry)
+
+	return entry
+}
+
+func (history *History) Get(id int) (HistoryEntry, bool) {
+	history.RLock()
+	defer history.RUnlock()
+
+	for _, entry := range history.entries {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// returns the entries from the oldest to the latest
+func (history *History) List() []HistoryEntry {
+	history.RLock()
+	defer history.RUnlock()
+
+	ret := make([]HistoryEntry, len(history.entries))
+	copy(ret, history.entries)
+	return ret
+}
+
+// returns the entries with reactions, from the most reacted,
+// the later entry comes first if the totals are equal
+func (history *History) Favorites() []HistoryEntry {
+	history.RLock()
+	defer history.RUnlock()
+
+	ret := []HistoryEntry{}
+	for i := len(history.entries) - 1; i >= 0; i-- {
+		if history.entries[i].ReactionTotal > 0 {
+			ret = append(ret, history.entries[i])
+		}
+	}
+	slices.SortStableFunc(ret, func(a, b HistoryEntry) int {
+		return cmp.Compare(b.ReactionTotal, a.ReactionTotal)
+	})
+	return ret
+}
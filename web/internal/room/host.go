@@ -0,0 +1,199 @@
+package room
+
+import (
+	"errors"
+)
+
+const (
+	// a client is granted the host permission
+	EVENT_HOST Event = "host"
+	// a host is demoted to trusted
+	EVENT_DEMOTE Event = "demote"
+	// a host becomes the driver of the music player
+	EVENT_DRIVER Event = "driver"
+	// a guest is granted the trusted permission
+	EVENT_TRUST Event = "trust"
+	// a trusted member is set back to guest
+	EVENT_UNTRUST Event = "untrust"
+)
+
+var (
+	ErrNotHost        = errors.New("client is not a host")
+	ErrIsHost         = errors.New("client is a host")
+	ErrLastHost       = errors.New("client is the last host of the room")
+	ErrClientNotFound = errors.New("client not found in the room")
+)
+
+type roleOp int
+
+const (
+	// hand the host role of from to to
+	ROLE_TRANSFER roleOp = iota
+	ROLE_PROMOTE
+	ROLE_DEMOTE
+	ROLE_DRIVER
+	ROLE_TRUST
+	ROLE_UNTRUST
+)
+
+type roleRequest struct {
+	op   roleOp
+	from *Client
+	to   *Client
+	done chan error
+}
+
+func (h *Hub) requestRole(op roleOp, from *Client, to *Client) error {
+	req := roleRequest{
+		op:   op,
+		from: from,
+		to:   to,
+		done: make(chan error, 1),
+	}
+	select {
+	case <-h.Destroy:
+		return ErrClientNotFound
+	case h.roles <- req:
+	}
+	return <-req.done
+}
+
+// TransferHost hands the host role from a host to another client of the room,
+// the driver role is handed over as well
+func (h *Hub) TransferHost(from *Client, to *Client) error {
+	return h.requestRole(ROLE_TRANSFER, from, to)
+}
+
+// Promote grants the host permission to the client
+func (h *Hub) Promote(client *Client) error {
+	return h.requestRole(ROLE_PROMOTE, nil, client)
+}
+
+// Demote sets the host to trusted, the last host can not be demoted
+func (h *Hub) Demote(client *Client) error {
+	return h.requestRole(ROLE_DEMOTE, nil, client)
+}
+
+// SetDriver designates the host to drive the music player
+func (h *Hub) SetDriver(client *Client) error {
+	return h.requestRole(ROLE_DRIVER, nil, client)
+}
+
+// Trust grants the trusted permission to a guest, or sets a trusted member back to guest.
+// The permission of a host is changed by Demote
+func (h *Hub) Trust(client *Client, trusted bool) error {
+	if trusted {
+		return h.requestRole(ROLE_TRUST, nil, client)
+	}
+	return h.requestRole(ROLE_UNTRUST, nil, client)
+}
+
+// must be called in the hub loop with ClientMapMutex held
+func (h *Hub) changeRole(req roleRequest) error {
+	if _, ok := h.Clients[req.to]; !ok || req.to == req.from {
+		return ErrClientNotFound
+	}
+
+	switch req.op {
+	case ROLE_TRANSFER:
+		if h.Clients[req.from] != PERMISSION_HOST {
+			return ErrNotHost
+		}
+		h.promote(req.to)
+		if h.Driver == req.from {
+			h.setDriver(req.to)
+		}
+		h.demote(req.from)
+	case ROLE_PROMOTE:
+		if h.Clients[req.to] != PERMISSION_HOST {
+			h.promote(req.to)
+		}
+	case ROLE_DEMOTE:
+		if h.Clients[req.to] != PERMISSION_HOST {
+			return ErrNotHost
+		}
+		hosts := 0
+		for _, permission := range h.Clients {
+			if permission == PERMISSION_HOST {
+				hosts++
+			}
+		}
+		if hosts <= 1 {
+			return ErrLastHost
+		}
+		h.demote(req.to)
+	case ROLE_DRIVER:
+		if h.Clients[req.to] != PERMISSION_HOST {
+			return ErrNotHost
+		}
+		if h.Driver != req.to {
+			h.setDriver(req.to)
+		}
+	case ROLE_TRUST, ROLE_UNTRUST:
+		if h.Clients[req.to] == PERMISSION_HOST {
+			return ErrIsHost
+		}
+		h.trust(req.to, req.op == ROLE_TRUST)
+	}
+	return nil
+}
+
+func (h *Hub) broadcastRole(client *Client, event Event) {
+	msg := BroadcastMessage[Event]{
+		MsgType:  MSG_EVENT_ROOM,
+		UID:      client.ID.String(),
+		Username: client.Name,
+		Data:     event,
+	}
+	go h.BroadcastMsg(&msg)
+}
+
+// must be called in the hub loop
+func (h *Hub) promote(client *Client) {
+	client.Permission = PERMISSION_HOST
+	h.Clients[client] = client.Permission
+	h.broadcastRole(client, EVENT_HOST)
+}
+
+// must be called in the hub loop
+func (h *Hub) trust(client *Client, trusted bool) {
+	permission, event := PERMISSION_GUEST, EVENT_UNTRUST
+	if trusted {
+		permission, event = PERMISSION_TRUSTED, EVENT_TRUST
+	}
+	if client.Permission == permission {
+		return
+	}
+	client.Permission = permission
+	h.Clients[client] = client.Permission
+	h.broadcastRole(client, event)
+}
+
+// the driver fails over to another host. must be called in the hub loop
+func (h *Hub) demote(client *Client) {
+	client.Permission = PERMISSION_TRUSTED
+	h.Clients[client] = client.Permission
+	h.broadcastRole(client, EVENT_DEMOTE)
+	if h.Driver == client {
+		h.failover()
+	}
+}
+
+// must be called in the hub loop
+func (h *Hub) setDriver(client *Client) {
+	h.Driver = client
+	h.broadcastRole(client, EVENT_DRIVER)
+}
+
+// the next host drives the music player when the driver leaves or is demoted,
+// the earliest joined client is promoted if there is no other host. must be called in the hub loop
+func (h *Hub) failover() {
+	next := h.NextDriver()
+	if next == nil {
+		return
+	}
+	if h.Clients[next] != PERMISSION_HOST {
+		h.promote(next)
+	}
+	h.setDriver(next)
+}
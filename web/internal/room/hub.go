@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -40,25 +41,43 @@ func (c *Client) B64ID() string {
 	return base64.RawURLEncoding.EncodeToString(c.ID[:])
 }
 
+// the context is cancelled when the hub is destroyed
+func (h *Hub) Context() context.Context {
+	return h.hubctx
+}
+
 // Hub should only control what a websocket hub should do
 // seperate the music streaming to the music player
 type Hub struct {
 	ID        uuid.UUID
 	hubctx    context.Context
 	hubcancel func()
-	Host      *Client
-	Clients   map[*Client]int // multiple host is allowed
+	Driver    *Client         // the host which plays the audio and advances the player, see IsDriver()
+	Clients   map[*Client]int // multiple host is allowed, clients with PERMISSION_HOST
 	Player    *MusicPlayer
+	History   *History
+	Invites   *Invites
+	Access    *Access
+	Bans      *Bans
+	Chat      *Chat
+	Reactions *Reactions
+	size      atomic.Int32 // the number of clients, it is read outside the hub loop by the message functions
 
 	// hub control channel
-	Register   chan *Client
-	Unregister chan *Client
-	Destroy    chan struct{}
+	Register     chan *Client
+	Destroy      chan struct{}
+	disconnected chan disconnectRequest
+	resume       chan resumeRequest
+	expire       chan disconnectRequest
+	kick         chan kickRequest
+	roles        chan roleRequest
 
 	// message channel
 	broadcast chan WSMessage
 	direct    chan WSMessage
 	peer      chan WSMessage
+	hosts     chan WSMessage
+	driver    chan MPStatus
 }
 
 func CreateHub(id uuid.UUID) *Hub {
@@ -67,18 +86,30 @@ func CreateHub(id uuid.UUID) *Hub {
 	// clients[client] = 7
 
 	return &Hub{
-		ID:      id,
-		Host:    nil,
-		Clients: clients,
-		Player:  CreateMusicPlayer(),
-
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Destroy:    make(chan struct{}),
+		ID:        id,
+		Driver:    nil,
+		Clients:   clients,
+		Player:    CreateMusicPlayer(id),
+		History:   NewHistory(),
+		Invites:   NewInvites(),
+		Access:    &Access{Policy: ACCESS_OPEN, pending: make(map[uuid.UUID]*pendingJoin)},
+		Bans:      NewBans(),
+		Chat:      NewChat(),
+		Reactions: NewReactions(),
+
+		Register:     make(chan *Client),
+		Destroy:      make(chan struct{}),
+		disconnected: make(chan disconnectRequest),
+		resume:       make(chan resumeRequest),
+		expire:       make(chan disconnectRequest),
+		kick:         make(chan kickRequest),
+		roles:        make(chan roleRequest),
 
 		broadcast: make(chan WSMessage),
 		direct:    make(chan WSMessage),
 		peer:      make(chan WSMessage),
+		hosts:     make(chan WSMessage),
+		driver:    make(chan MPStatus),
 	}
 }
 
@@ -96,6 +127,9 @@ func (h *Hub) Run() {
 	h.hubcancel = hubshutdown
 	go h.Player.Run(mpctx, h)
 
+	flushTicker := time.NewTicker(FLUSH_INTERVAL)
+	defer flushTicker.Stop()
+
 	for {
 		select {
 		case <-h.Destroy:
@@ -105,11 +139,64 @@ func (h *Hub) Run() {
 		case client := <-h.Register:
 			h.register(client)
 
-		case client := <-h.Unregister:
-			h.unregister(client)
+		case <-flushTicker.C:
+			h.flushAll()
+
+		case req := <-h.disconnected:
+			h.suspend(req.client, req.gen, req.leave)
+
+		case req := <-h.resume:
+			req.done <- h.resumeClient(req)
+
+		case req := <-h.expire:
+			h.expireClient(req.client, req.gen)
+
+		case req := <-h.kick:
+			req.client.closeReason = req.reason
+			h.remove(req.client, req.event)
+
+		case req := <-h.roles:
+			// the roles are read by the handlers under ClientMapMutex, like the membership of Clients
+			ClientMapMutex.Lock()
+			err := h.changeRole(req)
+			ClientMapMutex.Unlock()
+			req.done <- err
+
+		case msg := <-h.hosts:
+			msgJson, err := msg.Json()
+			class, key := deliveryOf(msg)
+			if err != nil {
+				log.Error().Err(err).Msg("[hub] hosts msg json encode error")
+				continue
+			}
+			for client, permission := range h.Clients {
+				if permission != PERMISSION_HOST {
+					continue
+				}
+				h.send(client, msgJson, class, key)
+			}
+
+		case status := <-h.driver:
+			// the driver is resolved in the loop, it may have left or been replaced since the status was sent
+			if h.Driver == nil {
+				continue
+			}
+			msg := DirectMessage[MPStatus]{
+				MsgType: MSG_EVENT_PLAYER,
+				To:      h.Driver.ID,
+				Data:    status,
+			}
+			msgJson, err := msg.Json()
+			class, key := deliveryOf(&msg)
+			if err != nil {
+				log.Error().Err(err).Msg("[hub] driver msg json encode error")
+				continue
+			}
+			h.send(h.Driver, msgJson, class, key)
 
 		case msg := <-h.broadcast:
 			msgJson, err := msg.Json()
+			class, key := deliveryOf(msg)
 			if err != nil {
 				log.Error().Err(err).
 					Str("sender", msg.Sender().ID.String()).
@@ -123,16 +210,12 @@ func (h *Hub) Run() {
 					Msg("[hub] ws broadcast msg")
 			}
 			for client := range h.Clients {
-				select {
-				case client.Send <- msgJson:
-				default:
-					close(client.Send)
-					delete(h.Clients, client)
-				}
+				h.send(client, msgJson, class, key)
 			}
 
 		case msg := <-h.direct:
 			msgJson, err := msg.Json()
+			class, key := deliveryOf(msg)
 			if err != nil {
 				log.Error().Err(err).
 					Str("sender", msg.Sender().ID.String()).
@@ -146,16 +229,12 @@ func (h *Hub) Run() {
 					Msg("[hub] ws direct msg")
 			}
 			if client := msg.Reciever(); client != nil {
-				select {
-				case client.Send <- msgJson:
-				default:
-					close(client.Send)
-					delete(h.Clients, client)
-				}
+				h.send(client, msgJson, class, key)
 			}
 
 		case msg := <-h.peer:
 			msgJson, err := msg.Json()
+			class, key := deliveryOf(msg)
 			if err != nil {
 				log.Error().Err(err).
 					Str("sender", msg.Sender().ID.String()).
@@ -171,12 +250,7 @@ func (h *Hub) Run() {
 
 			reciever := msg.Reciever()
 			if reciever != nil {
-				select {
-				case reciever.Send <- msgJson:
-				default:
-					close(reciever.Send)
-					delete(h.Clients, reciever)
-				}
+				h.send(reciever, msgJson, class, key)
 			} else {
 				sender := msg.Sender()
 				if sender == nil {
@@ -184,12 +258,7 @@ func (h *Hub) Run() {
 				}
 				for client := range h.Clients {
 					if client != sender {
-						select {
-						case client.Send <- msgJson:
-						default:
-							close(client.Send)
-							delete(h.Clients, client)
-						}
+						h.send(client, msgJson, class, key)
 					}
 				}
 			}
@@ -202,14 +271,29 @@ func (h *Hub) Run() {
 // channel functions
 
 func (h *Hub) register(client *Client) {
-	h.Clients[client] = client.Permission
-	// set host
-	if h.Host == nil {
-		h.Host = client
+	// the first client is the host and the driver
+	// the roles and the membership are read by the handlers under ClientMapMutex
+	ClientMapMutex.Lock()
+	if h.Driver == nil {
+		client.Permission = PERMISSION_HOST
+		h.Driver = client
 	}
+	if _, ok := h.Clients[client]; !ok {
+		h.size.Add(1)
+	}
+	h.Clients[client] = client.Permission
+	ClientMapMutex.Unlock()
+	client.replay = newReplayBuffer()
+	h.sendResumeToken(client)
+	h.sendChatHistory(client)
 }
 
 func (h *Hub) unregister(client *Client) {
+	h.remove(client, "left")
+}
+
+// remove the client from the hub, the event is broadcast to notify the others
+func (h *Hub) remove(client *Client, event Event) {
 	ClientMapMutex.Lock()
 	TokenMapMutex.Lock()
 
@@ -219,15 +303,18 @@ func (h *Hub) unregister(client *Client) {
 			MsgType:  MSG_EVENT_ROOM,
 			UID:      client.ID.String(),
 			Username: client.Name,
-			Data:     "left",
+			Data:     event,
 		}
 		go h.BroadcastMsg(&msg)
 
 		// clean up
 		delete(h.Clients, client)
+		h.size.Add(-1)
 		delete(ClientMap, client.ID)
 		delete(TokenMap, client.Token)
-		close(client.Send)
+		if !client.suspended {
+			close(client.Send)
+		}
 		// check if hub should be closed
 		if len(h.Clients) == 0 {
 			go func() {
@@ -249,16 +336,9 @@ func (h *Hub) unregister(client *Client) {
 			ClientMapMutex.Unlock()
 			return
 		} else {
-			// check host transfer
-			if h.Host.ID == client.ID {
-				h.Host = h.NextHost()
-				msg := BroadcastMessage[Event]{
-					MsgType:  MSG_EVENT_ROOM,
-					UID:      h.Host.ID.String(),
-					Username: h.Host.Name,
-					Data:     "host",
-				}
-				go h.BroadcastMsg(&msg)
+			// check driver failover
+			if h.Driver == client {
+				h.failover()
 			}
 		}
 	}
@@ -273,7 +353,7 @@ func (h *Hub) Timeout(sid *uuid.UUID) {
 	case <-time.After(TIMEOUT_HUB):
 		// close the hub if no one joined after some time
 		delete(NewHubs, *sid)
-		if len(h.Clients) == 0 {
+		if h.size.Load() == 0 {
 			select {
 			case <-h.Destroy:
 				// closed
@@ -289,25 +369,43 @@ func (h *Hub) Timeout(sid *uuid.UUID) {
 	}
 }
 
-func (h *Hub) NextHost() *Client {
-	// find the next client joined after the current host
+// the driver is changed in the hub loop with ClientMapMutex held,
+// it must not be called with ClientMapMutex held
+func (h *Hub) IsDriver(client *Client) bool {
+	ClientMapMutex.RLock()
+	defer ClientMapMutex.RUnlock()
+
+	return h.Driver == client
+}
+
+// find the host joined first except the driver, any client is returned if there is no other host
+func (h *Hub) NextDriver() *Client {
 	var min int64 = math.MaxInt64
 	var match *Client
-	for client := range h.Clients {
-		if client.ID == h.Host.ID {
+	var minHost int64 = math.MaxInt64
+	var matchHost *Client
+	for client, permission := range h.Clients {
+		if client == h.Driver {
 			continue
 		}
 		if client.JoinUnixMilli < min {
 			min = client.JoinUnixMilli
 			match = client
 		}
+		if permission == PERMISSION_HOST && client.JoinUnixMilli < minHost {
+			minHost = client.JoinUnixMilli
+			matchHost = client
+		}
+	}
+	if matchHost != nil {
+		return matchHost
 	}
 	return match
 }
 
 func (h *Hub) BroadcastMsg(msg WSMessage) {
 	// slog.Debug("broadcast start")
-	if len(h.Clients) > 0 {
+	if h.size.Load() > 0 {
 		select {
 		case <-h.Destroy:
 			log.Debug().Msg("[hub] broadcast destroy closed")
@@ -322,7 +420,7 @@ func (h *Hub) BroadcastMsg(msg WSMessage) {
 }
 
 func (h *Hub) DirectMsg(msg WSMessage) {
-	if len(h.Clients) > 0 {
+	if h.size.Load() > 0 {
 		select {
 		case <-h.Destroy:
 			log.Debug().Msg("[hub] direct message destroy closed")
@@ -334,8 +432,36 @@ func (h *Hub) DirectMsg(msg WSMessage) {
 	}
 }
 
+// send the message to every host of the room
+func (h *Hub) HostsMsg(msg WSMessage) {
+	if h.size.Load() > 0 {
+		select {
+		case <-h.Destroy:
+			log.Debug().Msg("[hub] hosts message destroy closed")
+			return
+		default:
+		}
+		h.hosts <- msg
+		return
+	}
+}
+
+// send the player status to the driver of the room, it is dropped if there is no driver
+func (h *Hub) DriverMsg(status MPStatus) {
+	if h.size.Load() > 0 {
+		select {
+		case <-h.Destroy:
+			log.Debug().Msg("[hub] driver message destroy closed")
+			return
+		default:
+		}
+		h.driver <- status
+		return
+	}
+}
+
 func (h *Hub) SignalMsg(msg WSMessage) {
-	if len(h.Clients) > 0 {
+	if h.size.Load() > 0 {
 		select {
 		case <-h.Destroy:
 			log.Debug().Msg("[hub] signal message destroy closed")
@@ -0,0 +1,189 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"main/internal/auth"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	INVITE_DEFAULT_TTL = 24 * time.Hour
+	INVITE_MAX_TTL     = 30 * 24 * time.Hour
+
+	// upper bound of the active invites of a room
+	MAX_INVITES = 50
+)
+
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteRevoked  = errors.New("invite is revoked")
+	ErrInviteExpired  = errors.New("invite is expired")
+	ErrInviteUsedUp   = errors.New("invite has no uses left")
+	ErrTooManyInvites = fmt.Errorf("room has more than %v active invites", MAX_INVITES)
+)
+
+// an invite created by the host, the token carries the signed claims
+type Invite struct {
+	ID         uuid.UUID
+	Token      string
+	Expiry     int64 // unix milli
+	MaxUses    int   // 0 for unlimited uses
+	Uses       int
+	Permission int    `json:",omitempty"` // granted to the invited client, 0 for the default
+	CreatedBy  string // uid
+	Created    int64
+	Revoked    bool
+}
+
+func (invite *Invite) check(now time.Time) error {
+	switch {
+	case invite.Revoked:
+		return ErrInviteRevoked
+	case now.UnixMilli() > invite.Expiry:
+		return ErrInviteExpired
+	case invite.MaxUses > 0 && invite.Uses >= invite.MaxUses:
+		return ErrInviteUsedUp
+	}
+	return nil
+}
+
+// Invites of a room, the room can be restricted to invited clients only
+type Invites struct {
+	sync.Mutex
+	required bool
+	invites  []*Invite // ordered by creation
+}
+
+func NewInvites() *Invites {
+	return &Invites{
+		invites: make([]*Invite, 0),
+	}
+}
+
+func ValidPermission(permission int) bool {
+	switch permission {
+	case PERMISSION_GUEST, PERMISSION_TRUSTED, PERMISSION_HOST:
+		return true
+	}
+	return false
+}
+
+// create an invite of the room, ttl and maxUses should be validated by the caller
+func (invites *Invites) Create(rid uuid.UUID, createdBy uuid.UUID, ttl time.Duration, maxUses int, permission int) (Invite, error) {
+	if permission != 0 && !ValidPermission(permission) {
+		return Invite{}, fmt.Errorf("invalid permission: %v", permission)
+	}
+
+	invites.Lock()
+	defer invites.Unlock()
+
+	// drop the invites which can not be used anymore
+	now := time.Now()
+	invites.invites = slices.DeleteFunc(invites.invites, func(invite *Invite) bool {
+		return invite.check(now) != nil
+	})
+	if len(invites.invites) >= MAX_INVITES {
+		return Invite{}, ErrTooManyInvites
+	}
+
+	claims := auth.Invite{
+		RID:        rid,
+		ID:         uuid.New(),
+		Expiry:     now.Add(ttl),
+		Permission: permission,
+	}
+	invite := &Invite{
+		ID:         claims.ID,
+		Token:      auth.InviteToken(claims),
+		Expiry:     claims.Expiry.UnixMilli(),
+		MaxUses:    maxUses,
+		Permission: permission,
+		CreatedBy:  createdBy.String(),
+		Created:    now.UnixMilli(),
+	}
+	invites.invites = append(invites.invites, invite)
+
+	return *invite, nil
+}
+
+func (invites *Invites) List() []Invite {
+	invites.Lock()
+	defer invites.Unlock()
+
+	ret := make([]Invite, len(invites.invites))
+	for i, invite := range invites.invites {
+		ret[i] = *invite
+	}
+	return ret
+}
+
+func (invites *Invites) find(id uuid.UUID) *Invite {
+	for _, invite := range invites.invites {
+		if invite.ID == id {
+			return invite
+		}
+	}
+	return nil
+}
+
+func (invites *Invites) Revoke(id uuid.UUID) error {
+	invites.Lock()
+	defer invites.Unlock()
+
+	invite := invites.find(id)
+	if invite == nil {
+		return ErrInviteNotFound
+	}
+	invite.Revoked = true
+	return nil
+}
+
+// Check returns the invite of the claims if it can be used, without using it
+func (invites *Invites) Check(claims auth.Invite) (Invite, error) {
+	invites.Lock()
+	defer invites.Unlock()
+
+	invite := invites.find(claims.ID)
+	if invite == nil {
+		return Invite{}, ErrInviteNotFound
+	}
+	if err := invite.check(time.Now()); err != nil {
+		return Invite{}, err
+	}
+	return *invite, nil
+}
+
+// Use counts a use of the invite, an error is returned if it can not be used
+func (invites *Invites) Use(claims auth.Invite) (Invite, error) {
+	invites.Lock()
+	defer invites.Unlock()
+
+	invite := invites.find(claims.ID)
+	if invite == nil {
+		return Invite{}, ErrInviteNotFound
+	}
+	if err := invite.check(time.Now()); err != nil {
+		return Invite{}, err
+	}
+	invite.Uses++
+	return *invite, nil
+}
+
+// the room can only be joined with an invite
+func (invites *Invites) Required() bool {
+	invites.Lock()
+	defer invites.Unlock()
+
+	return invites.required
+}
+
+func (invites *Invites) SetRequired(required bool) {
+	invites.Lock()
+	invites.required = required
+	invites.Unlock()
+}
@@ -0,0 +1,90 @@
+package room
+
+import (
+	"main/internal/auth"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func createInvite(t *testing.T, invites *Invites, ttl time.Duration, maxUses int) auth.Invite {
+	t.Helper()
+	invite, err := invites.Create(uuid.New(), uuid.New(), ttl, maxUses, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	claims, err := auth.ParseInviteToken(invite.Token)
+	if err != nil {
+		t.Fatalf("ParseInviteToken: %v", err)
+	}
+	return claims
+}
+
+func TestInviteMaxUses(t *testing.T) {
+	invites := NewInvites()
+	claims := createInvite(t, invites, time.Hour, 2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := invites.Use(claims); err != nil {
+			t.Fatalf("use %v: %v", i, err)
+		}
+	}
+	if _, err := invites.Use(claims); err != ErrInviteUsedUp {
+		t.Fatalf("err = %v, want %v", err, ErrInviteUsedUp)
+	}
+	if _, err := invites.Check(claims); err != ErrInviteUsedUp {
+		t.Fatalf("Check err = %v, want %v", err, ErrInviteUsedUp)
+	}
+}
+
+func TestInviteMaxUsesConcurrent(t *testing.T) {
+	invites := NewInvites()
+	claims := createInvite(t, invites, time.Hour, 5)
+
+	var used atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := invites.Use(claims); err == nil {
+				used.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if used.Load() != 5 {
+		t.Fatalf("the invite is used %v times, want 5", used.Load())
+	}
+}
+
+func TestInviteRevoked(t *testing.T) {
+	invites := NewInvites()
+	claims := createInvite(t, invites, time.Hour, 0)
+
+	if err := invites.Revoke(claims.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := invites.Use(claims); err != ErrInviteRevoked {
+		t.Fatalf("err = %v, want %v", err, ErrInviteRevoked)
+	}
+	if err := invites.Revoke(uuid.New()); err != ErrInviteNotFound {
+		t.Fatalf("err = %v, want %v", err, ErrInviteNotFound)
+	}
+}
+
+func TestInviteExpired(t *testing.T) {
+	invites := NewInvites()
+	invite, err := invites.Create(uuid.New(), uuid.New(), 10*time.Millisecond, 0, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := invites.Use(auth.Invite{ID: invite.ID}); err != ErrInviteExpired {
+		t.Fatalf("err = %v, want %v", err, ErrInviteExpired)
+	}
+}
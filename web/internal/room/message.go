@@ -29,6 +29,8 @@ const (
 	MSG_EVENT_PEER
 	MSG_EVENT_PLAYLIST
 	MSG_EVENT_PLAYER
+	MSG_EVENT_CHAT
+	MSG_EVENT_REACTION
 	MSG_RESERVED
 )
 
@@ -38,17 +40,22 @@ const (
 	INFOJSON_CMD_ADD    WSCMD = "ADD"
 	INFOJSON_CMD_REMOVE WSCMD = "REMOVE"
 	INFOJSON_CMD_SWAP   WSCMD = "SWAP"
+	INFOJSON_CMD_META   WSCMD = "META"  // metadata update of a node
+	INFOJSON_CMD_ORDER  WSCMD = "ORDER" // the upcoming nodes are reordered
 )
 
 type Event string
 type BMData interface {
-	Event | WSInfoJson
+	Event | WSInfoJson | PlayerSettings | JoinRequest | ChatEvent | ReactionEvent
 }
 
 type WSInfoJson struct {
 	ID             int
 	Cmd            WSCMD
-	MovedTo        int `json:",omitempty"`
+	MovedTo        int      `json:",omitempty"`
+	Gain           *float64 `json:",omitempty"`
+	AutoAdded      bool     `json:",omitempty"`
+	Order          []int    `json:",omitempty"` // node IDs of the playlist, from the head
 	ytdlp.InfoJson `json:",omitempty"`
 }
 
@@ -104,7 +111,7 @@ func (bm *BroadcastMessage[T]) DebugMode() bool {
 }
 
 type DMData interface {
-	[]byte | taskq.TaskStatus | MPStatus
+	[]byte | taskq.TaskStatus | MPStatus | JoinRequest | ResumeInfo | ChatEvent
 }
 
 type DirectMessage[T DMData] struct {
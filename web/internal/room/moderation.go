@@ -0,0 +1,101 @@
+package room
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EVENT_KICK Event = "kick"
+	EVENT_BAN  Event = "ban"
+)
+
+type kickRequest struct {
+	client *Client
+	event  Event
+	reason string
+}
+
+// Kick removes the client from the hub, its connection is closed with the reason
+func (h *Hub) Kick(client *Client, event Event, reason string) {
+	select {
+	case <-h.Destroy:
+		log.Debug().Msg("[hub] kick destroy closed")
+	case h.kick <- kickRequest{client: client, event: event, reason: reason}:
+	}
+}
+
+// a banned uid, the ban lasts until the room is closed
+type Ban struct {
+	UID      string
+	Username string
+	BannedBy string // uid
+	Created  int64  // unix milli
+}
+
+type Bans struct {
+	sync.RWMutex
+	bans map[uuid.UUID]Ban
+}
+
+func NewBans() *Bans {
+	return &Bans{
+		bans: make(map[uuid.UUID]Ban),
+	}
+}
+
+func (bans *Bans) Add(uid uuid.UUID, username string, bannedBy uuid.UUID) Ban {
+	bans.Lock()
+	defer bans.Unlock()
+
+	ban := Ban{
+		UID:      uid.String(),
+		Username: username,
+		BannedBy: bannedBy.String(),
+		Created:  time.Now().UnixMilli(),
+	}
+	bans.bans[uid] = ban
+	return ban
+}
+
+// returns false if the uid is not banned
+func (bans *Bans) Remove(uid uuid.UUID) bool {
+	bans.Lock()
+	defer bans.Unlock()
+
+	if _, ok := bans.bans[uid]; !ok {
+		return false
+	}
+	delete(bans.bans, uid)
+	return true
+}
+
+func (bans *Bans) Banned(uid uuid.UUID) bool {
+	bans.RLock()
+	defer bans.RUnlock()
+
+	_, ok := bans.bans[uid]
+	return ok
+}
+
+// the rooms with a ban refuse the uids which are not bound to a cookie or an account
+func (bans *Bans) Empty() bool {
+	bans.RLock()
+	defer bans.RUnlock()
+
+	return len(bans.bans) == 0
+}
+
+func (bans *Bans) List() []Ban {
+	bans.RLock()
+	defer bans.RUnlock()
+
+	ret := make([]Ban, 0, len(bans.bans))
+	for _, ban := range bans.bans {
+		ret = append(ret, ban)
+	}
+	return ret
+}
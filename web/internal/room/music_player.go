@@ -1,14 +1,17 @@
 package room
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"main/internal/source"
+	"main/internal/transcode"
 	"main/internal/ytdlp"
 	"main/utils/weaksync"
 	"net/http"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
@@ -16,9 +19,9 @@ import (
 func (mp *MusicPlayer) String() string {
 	var curPlaying string
 	var curID int
-	if mp.CurNode != nil {
-		curPlaying = mp.CurNode.InfoJson.FullTitle
-		curID = mp.CurNode.ID
+	if cur := mp.Current(); cur != nil {
+		curPlaying = cur.InfoJson.FullTitle
+		curID = cur.ID
 	} else {
 		curPlaying = "nil"
 		curID = -1
@@ -30,16 +33,32 @@ func (mp *MusicPlayer) String() string {
 
 // methods are not safe by default
 type MusicPlayer struct {
-	hub         *Hub // maybe no need to keep reference
-	Playlist    *Playlist
-	fetchLock   *sync.Mutex
-	NodeWGCnt   *weaksync.WaitGroupCnt
-	CurNode     *MusicInfo
-	AudioReader *bytes.Reader
+	hub       *Hub // maybe no need to keep reference
+	Playlist  *Playlist
+	fetchLock *sync.Mutex
+	NodeWGCnt *weaksync.WaitGroupCnt
+	CurNode   *MusicInfo
+
+	// CurNode and the media of the nodes are written with fetchLock and nodeLock held,
+	// the player reads them under fetchLock, the others use Current() and Media() as fetchLock is held during the downloads
+	nodeLock sync.RWMutex
+
+	settingsLock sync.RWMutex
+	settings     PlayerSettings
+
+	// playback schedule, guarded by fetchLock
+	startUnixMilli     int64 // start time of the current node
+	scheduledID        int   // the next node announced to the host
+	scheduledUnixMilli int64
+
+	autoplaying bool // an autoplay node is being picked, guarded by fetchLock
+
+	// broadcasts queued under fetchLock, sent by unlockFetch() once the lock is released
+	pendingMsgs []WSMessage
 
 	// playlist control channel
 	AddedSong chan struct{}
-	NextSong  chan struct{}
+	NextSong  chan bool // true if the current node is skipped
 	Preload   chan struct{}
 }
 
@@ -47,36 +66,84 @@ type MusicPlayer struct {
 type MPStatus struct {
 	NextID int
 	OK     bool
+	// scheduled start of the next node for gapless playback, 0 means as soon as possible
+	StartUnixMilli int64 `json:",omitempty"`
+	Crossfade      int   `json:",omitempty"` // ms
 }
 
-func CreateMusicPlayer() *MusicPlayer {
-	playlist := NewPlaylist()
+func CreateMusicPlayer(rid uuid.UUID) *MusicPlayer {
+	playlist := NewPlaylist(rid)
 
 	return &MusicPlayer{
-		Playlist:    playlist,
-		fetchLock:   &sync.Mutex{},
-		NodeWGCnt:   weaksync.CreateWaitGroupCnt(),
-		CurNode:     nil,
-		AudioReader: nil,
+		Playlist:  playlist,
+		fetchLock: &sync.Mutex{},
+		NodeWGCnt: weaksync.CreateWaitGroupCnt(),
+		CurNode:   nil,
+		settings:  DefaultPlayerSettings(),
 
 		AddedSong: make(chan struct{}),
-		NextSong:  make(chan struct{}),
+		NextSong:  make(chan bool),
 		Preload:   make(chan struct{}),
 	}
 }
 
-func (mp *MusicPlayer) NewAudioReader() *bytes.Reader {
-	var reader *bytes.Reader
-	if mp.CurNode != nil {
-		reader = bytes.NewReader(mp.CurNode.AudioByte)
+// the playing node, nil if nothing is playing
+func (mp *MusicPlayer) Current() *MusicInfo {
+	mp.nodeLock.RLock()
+	defer mp.nodeLock.RUnlock()
+
+	return mp.CurNode
+}
+
+// replace the playing node, must be called with fetchLock held
+func (mp *MusicPlayer) setCurrent(node *MusicInfo) {
+	mp.nodeLock.Lock()
+	defer mp.nodeLock.Unlock()
+
+	mp.CurNode = node
+}
+
+// the media of the node, empty until its audio is downloaded
+func (mp *MusicPlayer) Media(node *MusicInfo) NodeMedia {
+	mp.nodeLock.RLock()
+	defer mp.nodeLock.RUnlock()
+
+	return node.NodeMedia
+}
+
+// queue the broadcast until fetchLock is released, the player must not wait for the hub loop.
+// Must be called with fetchLock held
+func (mp *MusicPlayer) broadcastLater(msg WSMessage) {
+	mp.pendingMsgs = append(mp.pendingMsgs, msg)
+}
+
+// release fetchLock, then broadcast the messages queued while it was held
+func (mp *MusicPlayer) unlockFetch() {
+	msgs := mp.pendingMsgs
+	mp.pendingMsgs = nil
+	hub := mp.hub
+	mp.fetchLock.Unlock()
+
+	if hub == nil {
+		return
+	}
+	for _, msg := range msgs {
+		hub.BroadcastMsg(msg)
 	}
+}
 
-	return reader
+// find the node by id, from the current node and the playlist
+func (mp *MusicPlayer) Node(id int) *MusicInfo {
+	if cur := mp.Current(); cur != nil && cur.ID == id {
+		return cur
+	}
+	return mp.Playlist.Find(id)
 }
 
 func (mp *MusicPlayer) Run(ctx context.Context, h *Hub) {
 	defer func() {
 		mp.Playlist.Clear()
+		mp.Playlist.Release(mp.CurNode)
 		mp.hub = nil
 	}()
 
@@ -92,12 +159,19 @@ func (mp *MusicPlayer) Run(ctx context.Context, h *Hub) {
 			// slog.Debug("[mp] added", "status", mp)
 			mp.fetchLock.Lock()
 			mp.lazyInit(ctx)
-			mp.fetchLock.Unlock()
+			mp.unlockFetch()
 
-		case <-mp.NextSong:
+		case skipped := <-mp.NextSong:
 			mp.fetchLock.Lock()
-			mp.CurNode = nil
-			mp.AudioReader = nil
+			if mp.CurNode != nil {
+				h.History.Add(mp.CurNode, mp.startUnixMilli, skipped, h.Reactions.Take(mp.CurNode.ID))
+				mp.repeat(mp.CurNode, skipped)
+				mp.Playlist.Release(mp.CurNode)
+			}
+			mp.setCurrent(nil)
+			if mp.Playlist.Size() == 0 {
+				mp.autoplay(ctx)
+			}
 			if mp.Playlist.Size() > 0 {
 				// the node could be preloading
 				// download the audio if not present at the moment
@@ -107,18 +181,22 @@ func (mp *MusicPlayer) Run(ctx context.Context, h *Hub) {
 				mp.next()
 			}
 			mp.NodeWGCnt.Done()
-			mp.fetchLock.Unlock()
+			mp.unlockFetch()
 
 			// slog.Debug("[mp] next", "status", mp)
 
 		case <-mp.Preload:
 			// preloading the next song should not block the player
 			go func() {
+				mp.fetchLock.Lock()
+				defer mp.unlockFetch()
+				// pick the autoplay track ahead of time, it is preloaded once it is enqueued
+				if mp.Playlist.Size() == 0 {
+					mp.autoplay(ctx)
+				}
 				if mp.Playlist.Size() > 0 {
-					mp.fetchLock.Lock()
 					node := mp.Playlist.Head()
 					mp.download(ctx, node)
-					mp.fetchLock.Unlock()
 				}
 				// slog.Debug("[mp] preload", "status", mp)
 			}()
@@ -158,7 +236,7 @@ func (mp *MusicPlayer) download(mpctx context.Context, node *MusicInfo) {
 			ErrCh: make(chan error),
 			FinCh: make(chan struct{}),
 		}
-		status, _ := ytdlp.AudioDownloader.Submit(ctx, &req)
+		status, _ := source.SubmitAudio(ctx, &req)
 
 		// mq response
 		if status != http.StatusAccepted {
@@ -182,19 +260,93 @@ func (mp *MusicPlayer) download(mpctx context.Context, node *MusicInfo) {
 		}
 
 		// update node can send id,ok to host
-		node.AudioByte = req.Response
+		// the node can be downloaded again, e.g. preloaded twice.
+		// The encodings are built on request, the ones clients may be streaming already are kept
+		media := node.NodeMedia
+		media.AudioByte = req.Response
+		if media.Renditions == nil {
+			media.Renditions = transcode.NewRenditions(mpctx, media.AudioByte)
+		}
+		if media.HLS == nil {
+			media.HLS = transcode.NewHLSVariants(mpctx, media.AudioByte)
+		}
+		created := media.Loudness == nil
+		if created {
+			media.Loudness = transcode.NewLoudness(mpctx, media.AudioByte)
+		}
+		mp.nodeLock.Lock()
+		node.NodeMedia = media
+		mp.nodeLock.Unlock()
+		// the loudness is measured once the normalization is enabled, see SetSettings()
+		if created && mp.Settings().Normalization != NORMALIZE_OFF {
+			go mp.broadcastGain(node, media.Loudness)
+		}
 
 		mpstatus := MPStatus{
-			NextID: node.ID,
-			OK:     true,
+			NextID:         node.ID,
+			OK:             true,
+			StartUnixMilli: mp.schedule(node),
+			Crossfade:      mp.Settings().Crossfade,
 		}
-		msg := DirectMessage[MPStatus]{
-			MsgType: MSG_EVENT_PLAYER,
-			To:      mp.hub.Host.ID,
-			Data:    mpstatus,
+		// the hub is unset once the player stops, the driver is resolved in the hub loop
+		if hub := mp.hub; hub != nil {
+			hub.DriverMsg(mpstatus)
+		}
+	}
+}
+
+// measure the loudness of the downloaded nodes, the gains are broadcast once they are measured
+func (mp *MusicPlayer) measureLoudness() {
+	type measuring struct {
+		node     *MusicInfo
+		loudness *transcode.Loudness
+	}
+	nodes := []measuring{}
+	mp.nodeLock.RLock()
+	mp.Playlist.RLock()
+	if cur := mp.CurNode; cur != nil && cur.Loudness != nil {
+		nodes = append(nodes, measuring{cur, cur.Loudness})
+	}
+	for n := mp.Playlist.list.Head(); n != nil; n = n.Next() {
+		if node := *n.Val(); node.Loudness != nil {
+			nodes = append(nodes, measuring{node, node.Loudness})
 		}
-		mp.hub.DirectMsg(&msg)
 	}
+	mp.Playlist.RUnlock()
+	mp.nodeLock.RUnlock()
+
+	for _, m := range nodes {
+		go mp.broadcastGain(m.node, m.loudness)
+	}
+}
+
+// measure the loudness and broadcast the gain of the node.
+// The measurement runs under the player context, waiting ends when the player stops
+func (mp *MusicPlayer) broadcastGain(node *MusicInfo, loudness *transcode.Loudness) {
+	if err := loudness.Wait(context.Background()); err != nil {
+		return
+	}
+	gain := loudness.Gain
+	// the playlist is copied with the lock held, see MusicInfoList()
+	mp.Playlist.Lock()
+	node.Gain = &gain
+	mp.Playlist.Unlock()
+
+	hub := mp.hub
+	if hub == nil {
+		return
+	}
+	wsInfoJson := WSInfoJson{
+		ID:   node.ID,
+		Cmd:  INFOJSON_CMD_META,
+		Gain: &gain,
+	}
+	msg := BroadcastMessage[WSInfoJson]{
+		MsgType: MSG_EVENT_PLAYLIST,
+		UID:     uuid.Nil.String(),
+		Data:    wsInfoJson,
+	}
+	hub.BroadcastMsg(&msg)
 }
 
 func (mp *MusicPlayer) next() {
@@ -205,11 +357,39 @@ func (mp *MusicPlayer) next() {
 		log.Error().Err(err).Msg("[mp] Dequeue error in next()")
 		return
 	}
-	mp.CurNode = nextNode
-	mp.AudioReader = mp.NewAudioReader()
+	mp.setCurrent(nextNode)
+
+	// keep the announced schedule, the host calls "streamend" after the node has started
+	if mp.scheduledUnixMilli > 0 && mp.scheduledID == nextNode.ID {
+		mp.startUnixMilli = mp.scheduledUnixMilli
+	} else {
+		mp.startUnixMilli = time.Now().UnixMilli()
+	}
+	mp.scheduledUnixMilli = 0
+}
+
+// schedule the node to start when the current node ends, overlapped by the crossfade,
+// returns 0 if the end of the current node is unknown
+func (mp *MusicPlayer) schedule(node *MusicInfo) int64 {
+	cur := mp.CurNode
+	if cur == nil || cur == node || cur.Duration <= 0 || mp.startUnixMilli == 0 {
+		return 0
+	}
+	crossfade := int64(mp.Settings().Crossfade)
+	start := mp.startUnixMilli + int64(cur.Duration)*1000 - crossfade
+	if start <= time.Now().UnixMilli() {
+		return 0
+	}
+	mp.scheduledID = node.ID
+	mp.scheduledUnixMilli = start
+
+	return start
 }
 
 func (mp *MusicPlayer) MusicInfoList() []MusicInfo {
+	// the nodes are copied with their media
+	mp.nodeLock.RLock()
+	defer mp.nodeLock.RUnlock()
 	mp.Playlist.RLock()
 	defer mp.Playlist.RUnlock()
 
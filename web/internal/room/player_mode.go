@@ -0,0 +1,99 @@
+package room
+
+import (
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// requeue the played node by the repeat mode of the room, must be called with fetchLock held.
+// The events are broadcast once fetchLock is released
+func (mp *MusicPlayer) repeat(node *MusicInfo, skipped bool) {
+	hub := mp.hub
+	if hub == nil || node == nil {
+		return
+	}
+
+	var requeued *MusicInfo
+	switch mp.Settings().Repeat {
+	case REPEAT_ONE:
+		if skipped {
+			return
+		}
+		// the audio is kept, the node is played again without downloading.
+		// The gain is set under the playlist lock, see broadcastGain()
+		mp.Playlist.RLock()
+		copied := *node
+		mp.Playlist.RUnlock()
+		requeued = &copied
+		if err := mp.Playlist.EnqueueHead(requeued); err != nil {
+			log.Error().Err(err).Msg("[mp] repeat one enqueue error")
+			return
+		}
+	case REPEAT_ALL:
+		// the audio is dropped, it is downloaded again when the node reaches the head
+		requeued = &MusicInfo{
+			URL:          node.URL,
+			QueuedBy:     node.QueuedBy,
+			QueuedByName: node.QueuedByName,
+			AutoAdded:    node.AutoAdded,
+			InfoJson:     node.InfoJson,
+		}
+		if err := mp.Playlist.Enqueue(requeued); err != nil {
+			log.Error().Err(err).Msg("[mp] repeat all enqueue error")
+			return
+		}
+	default:
+		return
+	}
+
+	wsInfoJson := WSInfoJson{
+		ID:        requeued.ID,
+		Cmd:       INFOJSON_CMD_ADD,
+		AutoAdded: requeued.AutoAdded,
+		InfoJson:  requeued.InfoJson,
+	}
+	msg := BroadcastMessage[WSInfoJson]{
+		MsgType: MSG_EVENT_PLAYLIST,
+		UID:     uuid.Nil.String(),
+		Data:    wsInfoJson,
+	}
+	mp.broadcastLater(&msg)
+	if requeued == mp.Playlist.Head() && mp.Playlist.Size() > 1 {
+		mp.broadcastOrder(uuid.Nil.String(), "", mp.Playlist.Order())
+	}
+}
+
+// Shuffle randomizes the upcoming nodes once and broadcasts the new order.
+// The head is kept in place once its audio is downloaded, as the host may have preloaded it.
+// fetchLock waits for the head being preloaded, so the shuffle cannot move it away mid download
+func (mp *MusicPlayer) Shuffle(uid, username string) error {
+	mp.fetchLock.Lock()
+	defer mp.unlockFetch()
+
+	keepHead := false
+	if head := mp.Playlist.Head(); head != nil && len(head.AudioByte) > 0 {
+		keepHead = true
+	}
+	order, err := mp.Playlist.Shuffle(keepHead)
+	if err != nil {
+		return err
+	}
+	mp.broadcastOrder(uid, username, order)
+
+	return nil
+}
+
+// queue the ORDER event, must be called with fetchLock held
+func (mp *MusicPlayer) broadcastOrder(uid, username string, order []int) {
+	wsInfoJson := WSInfoJson{
+		Cmd:   INFOJSON_CMD_ORDER,
+		Order: order,
+	}
+	msg := BroadcastMessage[WSInfoJson]{
+		MsgType:  MSG_EVENT_PLAYLIST,
+		UID:      uid,
+		Username: username,
+		Data:     wsInfoJson,
+	}
+	mp.broadcastLater(&msg)
+}
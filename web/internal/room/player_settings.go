@@ -0,0 +1,103 @@
+package room
+
+import (
+	"fmt"
+)
+
+const (
+	// upper bound of the crossfade duration in ms
+	MAX_CROSSFADE = 12000
+)
+
+type NormalizeMode string
+
+const (
+	// no loudness normalization
+	NORMALIZE_OFF NormalizeMode = "OFF"
+	// the measured gain is broadcast with the track, clients apply it
+	NORMALIZE_CLIENT NormalizeMode = "CLIENT"
+	// the server applies the gain to the served audio
+	NORMALIZE_SERVER NormalizeMode = "SERVER"
+)
+
+type RepeatMode string
+
+const (
+	REPEAT_OFF RepeatMode = "OFF"
+	// the current node is played again unless it is skipped
+	REPEAT_ONE RepeatMode = "ONE"
+	// the played node is appended to the end of the playlist
+	REPEAT_ALL RepeatMode = "ALL"
+)
+
+// room level settings of the music player, changed by the host
+type PlayerSettings struct {
+	Normalization NormalizeMode
+	Crossfade     int  // ms, the next node is scheduled to start before the current one ends
+	Autoplay      bool // enqueue a related track when the playlist runs dry
+	Repeat        RepeatMode
+}
+
+func DefaultPlayerSettings() PlayerSettings {
+	return PlayerSettings{
+		Normalization: NORMALIZE_CLIENT,
+		Repeat:        REPEAT_OFF,
+	}
+}
+
+func (s *PlayerSettings) Validate() error {
+	switch s.Normalization {
+	case NORMALIZE_OFF, NORMALIZE_CLIENT, NORMALIZE_SERVER:
+	default:
+		return fmt.Errorf("invalid normalization mode: %v", s.Normalization)
+	}
+	switch s.Repeat {
+	case REPEAT_OFF, REPEAT_ONE, REPEAT_ALL:
+	default:
+		return fmt.Errorf("invalid repeat mode: %v", s.Repeat)
+	}
+	if s.Crossfade < 0 || s.Crossfade > MAX_CROSSFADE {
+		return fmt.Errorf("crossfade should be within 0 to %v ms, given: %v", MAX_CROSSFADE, s.Crossfade)
+	}
+
+	return nil
+}
+
+func (mp *MusicPlayer) Settings() PlayerSettings {
+	mp.settingsLock.RLock()
+	defer mp.settingsLock.RUnlock()
+
+	return mp.settings
+}
+
+func (mp *MusicPlayer) SetSettings(settings PlayerSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	mp.settingsLock.Lock()
+	prev := mp.settings
+	mp.settings = settings
+	mp.settingsLock.Unlock()
+
+	// the loudness is only measured while the normalization is enabled
+	if prev.Normalization == NORMALIZE_OFF && settings.Normalization != NORMALIZE_OFF {
+		mp.measureLoudness()
+	}
+
+	return nil
+}
+
+// set the repeat mode only, returns the updated settings
+func (mp *MusicPlayer) SetRepeat(mode RepeatMode) (PlayerSettings, error) {
+	mp.settingsLock.Lock()
+	defer mp.settingsLock.Unlock()
+
+	settings := mp.settings
+	settings.Repeat = mode
+	if err := settings.Validate(); err != nil {
+		return mp.settings, err
+	}
+	mp.settings = settings
+
+	return settings, nil
+}
@@ -1,11 +1,17 @@
 package room
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"main/internal/transcode"
+	"main/internal/upload"
 	"main/internal/ytdlp"
 	"main/utils/linkedlist"
+	"math/rand/v2"
 	"sync"
+
+	"github.com/google/uuid"
 )
 
 const (
@@ -24,29 +30,72 @@ func (a *autoIncID) ID() int {
 	return a.id
 }
 
+// NodeMedia is the downloaded audio of a node and the encodings built from it.
+// It is set by the player when the download is finished, read it with MusicPlayer.Media()
+type NodeMedia struct {
+	AudioByte  []byte
+	Renditions *transcode.Renditions
+	HLS        *transcode.HLSVariants
+	Loudness   *transcode.Loudness
+}
+
 type MusicInfo struct {
-	ID        int
-	URL       string `json:"-"`
-	AudioByte []byte `json:"-"`
+	ID           int
+	URL          string `json:"-"`
+	NodeMedia    `json:"-"`
+	Gain         *float64 `json:",omitempty"` // dB, set after the loudness is measured
+	QueuedBy     string   // uid
+	QueuedByName string
+	AutoAdded    bool `json:",omitempty"` // enqueued by autoplay
 	// InfoJson  ytdlp.InfoJson
 	ytdlp.InfoJson
 }
 
+// returns the transcoded audio if it is ready, the transcoding is started otherwise
+func (media NodeMedia) Rendition(q transcode.Quality) ([]byte, transcode.Rendition, bool) {
+	return media.Renditions.Get(q)
+}
+
+// returns the audio with the gain applied by the server,
+// it blocks until the loudness is measured and the audio is normalized
+func (media NodeMedia) NormalizedAudio(ctx context.Context, q transcode.Quality) ([]byte, transcode.Rendition, error) {
+	if err := media.Loudness.Wait(ctx); err != nil {
+		return nil, transcode.Rendition{}, err
+	}
+
+	return media.Loudness.Normalized(ctx, media.AudioByte, q)
+}
+
 // type MusicInfo is not comparable,
 // pointer to pointer to MusicInfo is needed
 type Playlist struct {
 	sync.RWMutex
+	rid    uuid.UUID // the room, uploaded files of other rooms can not be queued
 	list   *linkedlist.List[*MusicInfo]
 	autoID autoIncID
 }
 
-func NewPlaylist() *Playlist {
+func NewPlaylist(rid uuid.UUID) *Playlist {
 	return &Playlist{
+		rid:    rid,
 		list:   linkedlist.New[*MusicInfo](),
 		autoID: autoIncID{id: -1},
 	}
 }
 
+// the uploaded file of the node is kept while the node is queued or playing,
+// Release() must be called once the node is dropped
+func (playlist *Playlist) pin(info *MusicInfo) error {
+	return upload.Default.Pin(info.URL, playlist.rid)
+}
+
+// Release unpins the uploaded file of a node which has left the playlist, e.g. the played node
+func (playlist *Playlist) Release(info *MusicInfo) {
+	if info != nil {
+		upload.Default.Unpin(info.URL)
+	}
+}
+
 func (playlist *Playlist) Enqueue(info *MusicInfo) error {
 	playlist.Lock()
 	defer playlist.Unlock()
@@ -54,9 +103,35 @@ func (playlist *Playlist) Enqueue(info *MusicInfo) error {
 	if playlist.list.Size() >= LIST_MAX_SIZE {
 		return errors.New("enqueue err: playlist reached max size")
 	}
+	if err := playlist.pin(info); err != nil {
+		return err
+	}
 
 	info.ID = playlist.autoID.ID()
 	if err := playlist.list.InsertTail(&info); err != nil {
+		playlist.Release(info)
+		return err
+	}
+
+	return nil
+}
+
+// insert the node to the head of the playlist, it is the next node to be played
+func (playlist *Playlist) EnqueueHead(info *MusicInfo) error {
+	playlist.Lock()
+	defer playlist.Unlock()
+
+	if playlist.list.Size() >= LIST_MAX_SIZE {
+		return errors.New("enqueue err: playlist reached max size")
+	}
+
+	if err := playlist.pin(info); err != nil {
+		return err
+	}
+
+	info.ID = playlist.autoID.ID()
+	if err := playlist.list.InsertHead(&info); err != nil {
+		playlist.Release(info)
 		return err
 	}
 
@@ -75,8 +150,12 @@ func (playlist *Playlist) Remove(id int) error {
 	}
 
 	if n != nil {
-		err := playlist.list.Remove(n)
-		return err
+		info := *n.Val()
+		if err := playlist.list.Remove(n); err != nil {
+			return err
+		}
+		playlist.Release(info)
+		return nil
 	}
 
 	return errors.New("id not found")
@@ -154,10 +233,70 @@ func (playlist *Playlist) Head() *MusicInfo {
 	return *info
 }
 
+func (playlist *Playlist) Find(id int) *MusicInfo {
+	playlist.RLock()
+	defer playlist.RUnlock()
+
+	for n := playlist.list.Head(); n != nil; n = n.Next() {
+		if infoPtr := n.Val(); (*infoPtr).ID == id {
+			return *infoPtr
+		}
+	}
+
+	return nil
+}
+
+// Shuffle randomizes the order of the playlist once, the head is kept in place if keepHead is set.
+// Returns the node IDs in the new order
+func (playlist *Playlist) Shuffle(keepHead bool) ([]int, error) {
+	playlist.Lock()
+	defer playlist.Unlock()
+
+	infos := []*MusicInfo{}
+	for n := playlist.list.Head(); n != nil; n = n.Next() {
+		infos = append(infos, *n.Val())
+	}
+	start := 0
+	if keepHead && len(infos) > 0 {
+		start = 1
+	}
+	rest := infos[start:]
+	rand.Shuffle(len(rest), func(i, j int) {
+		rest[i], rest[j] = rest[j], rest[i]
+	})
+
+	playlist.list.Init()
+	order := make([]int, 0, len(infos))
+	for _, info := range infos {
+		if err := playlist.list.InsertTail(&info); err != nil {
+			return nil, err
+		}
+		order = append(order, info.ID)
+	}
+
+	return order, nil
+}
+
+// node IDs of the playlist, from the head
+func (playlist *Playlist) Order() []int {
+	playlist.RLock()
+	defer playlist.RUnlock()
+
+	order := make([]int, 0, playlist.list.Size())
+	for n := playlist.list.Head(); n != nil; n = n.Next() {
+		order = append(order, (*n.Val()).ID)
+	}
+
+	return order
+}
+
 func (playlist *Playlist) Clear() {
 	playlist.Lock()
 	defer playlist.Unlock()
 
+	for n := playlist.list.Head(); n != nil; n = n.Next() {
+		playlist.Release(*n.Val())
+	}
 	playlist.list.Init()
 }
 
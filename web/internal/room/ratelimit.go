@@ -0,0 +1,77 @@
+package room
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket, a token is refilled every interval up to the burst.
+// The zero value is a full bucket
+type rateLimiter struct {
+	sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// consume a token, returns false if the bucket is empty
+func (rl *rateLimiter) Allow(burst int, interval time.Duration) bool {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := time.Now()
+	if rl.last.IsZero() {
+		rl.tokens = float64(burst)
+	} else {
+		rl.tokens += float64(now.Sub(rl.last)) / float64(interval)
+		rl.tokens = min(rl.tokens, float64(burst))
+	}
+	rl.last = now
+	if rl.tokens < 1 {
+		return false
+	}
+	rl.tokens--
+
+	return true
+}
+
+// the idle buckets are swept once there are RATE_LIMITERS_SWEEP_SIZE keys
+const RATE_LIMITERS_SWEEP_SIZE = 1024
+
+// rateLimiters keeps a bucket per key, e.g. the remote address.
+// The zero value is ready to use
+type rateLimiters struct {
+	sync.Mutex
+	buckets map[string]*rateLimiter
+}
+
+// consume a token of the key, returns false if its bucket is empty
+func (rls *rateLimiters) Allow(key string, burst int, interval time.Duration) bool {
+	rls.Lock()
+	if rls.buckets == nil {
+		rls.buckets = make(map[string]*rateLimiter)
+	}
+	rl, ok := rls.buckets[key]
+	if !ok {
+		if len(rls.buckets) >= RATE_LIMITERS_SWEEP_SIZE {
+			rls.sweep(time.Duration(burst) * interval)
+		}
+		rl = &rateLimiter{}
+		rls.buckets[key] = rl
+	}
+	rls.Unlock()
+
+	return rl.Allow(burst, interval)
+}
+
+// drop the buckets idle long enough to be full again, rls should be locked by the caller
+func (rls *rateLimiters) sweep(refill time.Duration) {
+	now := time.Now()
+	for key, rl := range rls.buckets {
+		rl.Lock()
+		idle := now.Sub(rl.last) >= refill
+		rl.Unlock()
+		if idle {
+			delete(rls.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package room
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	var rl rateLimiter
+	for i := 0; i < 3; i++ {
+		if !rl.Allow(3, time.Hour) {
+			t.Fatalf("attempt %v is refused within the burst", i)
+		}
+	}
+	if rl.Allow(3, time.Hour) {
+		t.Fatal("the attempt is allowed after the burst")
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	var rl rateLimiter
+	interval := 20 * time.Millisecond
+	rl.Allow(1, interval)
+	if rl.Allow(1, interval) {
+		t.Fatal("the attempt is allowed before the refill")
+	}
+	time.Sleep(interval + 5*time.Millisecond)
+	if !rl.Allow(1, interval) {
+		t.Fatal("the attempt is refused after the refill")
+	}
+
+	// the bucket is not refilled over the burst
+	time.Sleep(5 * interval)
+	if !rl.Allow(1, interval) || rl.Allow(1, interval) {
+		t.Fatal("the bucket is refilled over the burst")
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	var rl rateLimiter
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rl.Allow(10, time.Hour) {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() != 10 {
+		t.Fatalf("%v attempts are allowed, want 10", allowed.Load())
+	}
+}
+
+func TestRateLimitersKeys(t *testing.T) {
+	var rls rateLimiters
+	if !rls.Allow("a", 1, time.Hour) {
+		t.Fatal("the first attempt of a is refused")
+	}
+	if rls.Allow("a", 1, time.Hour) {
+		t.Fatal("the second attempt of a is allowed")
+	}
+	if !rls.Allow("b", 1, time.Hour) {
+		t.Fatal("the attempt of b is refused by the bucket of a")
+	}
+}
+
+func TestRateLimitersSweep(t *testing.T) {
+	var rls rateLimiters
+	interval := time.Millisecond
+	for i := 0; i < RATE_LIMITERS_SWEEP_SIZE; i++ {
+		rls.Allow(fmt.Sprint(i), 1, interval)
+	}
+	// the idle buckets are full again, they are dropped by the next key
+	time.Sleep(5 * interval)
+	rls.Allow("new", 1, interval)
+	if len(rls.buckets) != 1 {
+		t.Fatalf("%v buckets are kept after the sweep, want 1", len(rls.buckets))
+	}
+
+	// the buckets which are not full are kept
+	rls = rateLimiters{}
+	for i := 0; i < RATE_LIMITERS_SWEEP_SIZE; i++ {
+		rls.Allow(fmt.Sprint(i), 1, time.Hour)
+	}
+	rls.Allow("another", 1, time.Hour)
+	if len(rls.buckets) != RATE_LIMITERS_SWEEP_SIZE+1 {
+		t.Fatalf("%v buckets are kept, want %v", len(rls.buckets), RATE_LIMITERS_SWEEP_SIZE+1)
+	}
+}
@@ -0,0 +1,169 @@
+package room
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// a client can send REACTION_RATE_BURST reactions at once, then one reaction every REACTION_RATE_INTERVAL
+	REACTION_RATE_BURST    = 10
+	REACTION_RATE_INTERVAL = 500 * time.Millisecond
+
+	// the updated counts are broadcast at most once per interval
+	REACTION_BROADCAST_INTERVAL = time.Second
+
+	// REACTION_ANY_NODE reacts to the node playing at the moment
+	REACTION_ANY_NODE = -1
+)
+
+var (
+	// the emoji a client can react with
+	REACTION_EMOJI = []string{"👍", "❤️", "🔥", "😂", "😮", "😢"}
+
+	ErrReactionInvalid     = errors.New("invalid reaction")
+	ErrReactionRateLimited = errors.New("too many reactions")
+	ErrReactionNotPlaying  = errors.New("the node is not playing")
+)
+
+// the reaction counts of a node, keyed by the emoji
+type ReactionEvent struct {
+	NodeID int
+	Counts map[string]int
+}
+
+// Reactions aggregates the reactions to the current node until it is moved to the history
+type Reactions struct {
+	sync.Mutex
+	counts  map[int]map[string]int // node ID -> emoji -> count
+	nodeID  int                    // the last reacted node
+	pending bool                   // a broadcast is scheduled
+
+	// the nodes moved to the history, a late reaction must not count them again.
+	// Only the last HISTORY_MAX_SIZE are kept, older nodes can not be playing anymore
+	taken      map[int]struct{}
+	takenOrder []int
+}
+
+func NewReactions() *Reactions {
+	return &Reactions{
+		counts: make(map[int]map[string]int),
+		taken:  make(map[int]struct{}),
+	}
+}
+
+func ValidReaction(emoji string) bool {
+	return slices.Contains(REACTION_EMOJI, emoji)
+}
+
+// add the reaction, returns true if a broadcast should be scheduled.
+// The reaction is refused if the node is moved to the history already
+func (reactions *Reactions) add(nodeID int, emoji string) (bool, error) {
+	reactions.Lock()
+	defer reactions.Unlock()
+
+	if _, ok := reactions.taken[nodeID]; ok {
+		return false, ErrReactionNotPlaying
+	}
+	counts, ok := reactions.counts[nodeID]
+	if !ok {
+		counts = make(map[string]int)
+		reactions.counts[nodeID] = counts
+	}
+	counts[emoji]++
+	reactions.nodeID = nodeID
+	if reactions.pending {
+		return false, nil
+	}
+	reactions.pending = true
+	return true, nil
+}
+
+// the counts of the last reacted node, ok is false if it is already moved to the history
+func (reactions *Reactions) flush() (ReactionEvent, bool) {
+	reactions.Lock()
+	defer reactions.Unlock()
+
+	reactions.pending = false
+	counts, ok := reactions.counts[reactions.nodeID]
+	if !ok {
+		return ReactionEvent{}, false
+	}
+	return ReactionEvent{NodeID: reactions.nodeID, Counts: maps.Clone(counts)}, true
+}
+
+// the counts of the node, empty if nobody reacted
+func (reactions *Reactions) Get(nodeID int) ReactionEvent {
+	reactions.Lock()
+	defer reactions.Unlock()
+
+	counts := maps.Clone(reactions.counts[nodeID])
+	if counts == nil {
+		counts = make(map[string]int)
+	}
+	return ReactionEvent{NodeID: nodeID, Counts: counts}
+}
+
+// Take removes the counts of the node and returns them, nil if nobody reacted
+func (reactions *Reactions) Take(nodeID int) map[string]int {
+	reactions.Lock()
+	defer reactions.Unlock()
+
+	counts := reactions.counts[nodeID]
+	delete(reactions.counts, nodeID)
+	if _, ok := reactions.taken[nodeID]; !ok {
+		if len(reactions.takenOrder) >= HISTORY_MAX_SIZE {
+			delete(reactions.taken, reactions.takenOrder[0])
+			reactions.takenOrder = reactions.takenOrder[1:]
+		}
+		reactions.taken[nodeID] = struct{}{}
+		reactions.takenOrder = append(reactions.takenOrder, nodeID)
+	}
+	return counts
+}
+
+// React counts the reaction of the client to the current node, nodeID is REACTION_ANY_NODE or the node
+// the client reacts to, which has to be playing. The updated counts are broadcast to the room after REACTION_BROADCAST_INTERVAL
+func (h *Hub) React(client *Client, nodeID int, emoji string) error {
+	if !ValidReaction(emoji) {
+		return ErrReactionInvalid
+	}
+	node := h.Player.Current()
+	if node == nil || (nodeID != REACTION_ANY_NODE && node.ID != nodeID) {
+		return ErrReactionNotPlaying
+	}
+	if !client.reactLimit.Allow(REACTION_RATE_BURST, REACTION_RATE_INTERVAL) {
+		return ErrReactionRateLimited
+	}
+
+	// the node may have ended since it was read, add refuses it then
+	broadcast, err := h.Reactions.add(node.ID, emoji)
+	if err != nil {
+		return err
+	}
+	if broadcast {
+		time.AfterFunc(REACTION_BROADCAST_INTERVAL, h.broadcastReactions)
+	}
+	return nil
+}
+
+func (h *Hub) broadcastReactions() {
+	if h.hubctx.Err() != nil {
+		return
+	}
+	event, ok := h.Reactions.flush()
+	if !ok {
+		return
+	}
+	msg := BroadcastMessage[ReactionEvent]{
+		MsgType: MSG_EVENT_REACTION,
+		UID:     uuid.Nil.String(),
+		Data:    event,
+	}
+	h.BroadcastMsg(&msg)
+}
@@ -0,0 +1,213 @@
+package room
+
+import (
+	"errors"
+	"main/internal/auth"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// the messages kept for a client to resume
+	REPLAY_BUFFER_SIZE = 256
+)
+
+var (
+	// a disconnected client keeps its slot in the room for the grace period, 0 to disable
+	RESUME_GRACE_PERIOD = func() time.Duration {
+		envar := os.Getenv("RESUME_GRACE_PERIOD")
+		if envar == "" {
+			return 30 * time.Second
+		}
+		grace, err := time.ParseDuration(envar)
+		if err != nil || grace < 0 {
+			log.Error().Err(err).Msg("Invalid env: RESUME_GRACE_PERIOD")
+			return 30 * time.Second
+		}
+		return grace
+	}()
+
+	ErrReplayGap = errors.New("missed messages are no longer available")
+)
+
+// sent to the client when it joins, the token is used to resume the session after a disconnection
+type ResumeInfo struct {
+	Resume string
+	Grace  int // seconds
+}
+
+type replayEntry struct {
+	seq uint64
+	msg []byte
+}
+
+// ring buffer of the messages sent to a client, the seq of the first message is 1
+type replayBuffer struct {
+	entries []replayEntry
+	seq     uint64 // seq of the latest message
+}
+
+func newReplayBuffer() *replayBuffer {
+	return &replayBuffer{
+		entries: make([]replayEntry, REPLAY_BUFFER_SIZE),
+	}
+}
+
+func (rb *replayBuffer) push(msg []byte) {
+	rb.seq++
+	rb.entries[rb.seq%REPLAY_BUFFER_SIZE] = replayEntry{seq: rb.seq, msg: msg}
+}
+
+// the messages after the seq, false if some of them are dropped already or the seq is ahead
+func (rb *replayBuffer) since(seq uint64) ([][]byte, bool) {
+	if seq > rb.seq || rb.seq-seq > REPLAY_BUFFER_SIZE {
+		return nil, false
+	}
+	ret := make([][]byte, 0, rb.seq-seq)
+	for i := seq + 1; i <= rb.seq; i++ {
+		ret = append(ret, rb.entries[i%REPLAY_BUFFER_SIZE].msg)
+	}
+	return ret, true
+}
+
+type disconnectRequest struct {
+	client *Client
+	gen    int
+	leave  bool
+}
+
+type resumeRequest struct {
+	client *Client
+	conn   *websocket.Conn
+	seq    uint64
+	done   chan error
+}
+
+// the connection of the generation is closed, the client leaves the room on purpose or it can resume
+func (h *Hub) disconnect(client *Client, gen int, leave bool) {
+	select {
+	case <-h.Destroy:
+	case h.disconnected <- disconnectRequest{client: client, gen: gen, leave: leave}:
+	}
+}
+
+// must be called in the hub loop
+func (h *Hub) suspend(client *Client, gen int, leave bool) {
+	if _, ok := h.Clients[client]; !ok || client.connGen != gen || client.suspended {
+		return
+	}
+	if leave || RESUME_GRACE_PERIOD == 0 {
+		h.unregister(client)
+		return
+	}
+
+	// stop the writer, the messages are kept in the replay buffer until the client resumes
+	client.suspended = true
+	close(client.Send)
+	for _, msgJson := range client.outbox.drain() {
+		client.replay.push(msgJson)
+	}
+	time.AfterFunc(RESUME_GRACE_PERIOD, func() {
+		select {
+		case <-h.Destroy:
+		case h.expire <- disconnectRequest{client: client, gen: gen}:
+		}
+	})
+	log.Info().
+		Str("uid", client.ID.String()).
+		Str("rid", h.B64ID()).
+		Msg("[hub] client suspended")
+}
+
+// must be called in the hub loop
+func (h *Hub) expireClient(client *Client, gen int) {
+	if _, ok := h.Clients[client]; !ok || client.connGen != gen || !client.suspended {
+		return
+	}
+	log.Info().
+		Str("uid", client.ID.String()).
+		Str("rid", h.B64ID()).
+		Msg("[hub] client resume expired")
+	h.unregister(client)
+}
+
+// Resume replaces the connection of the client and sends the messages after the seq,
+// the previous connection is closed if it is still open
+func (h *Hub) Resume(client *Client, conn *websocket.Conn, seq uint64) error {
+	req := resumeRequest{
+		client: client,
+		conn:   conn,
+		seq:    seq,
+		done:   make(chan error, 1),
+	}
+	select {
+	case <-h.Destroy:
+		return ErrClientNotFound
+	case h.resume <- req:
+	}
+	return <-req.done
+}
+
+// must be called in the hub loop
+func (h *Hub) resumeClient(req resumeRequest) error {
+	client := req.client
+	if _, ok := h.Clients[client]; !ok {
+		return ErrClientNotFound
+	}
+	// the waiting messages are sent after the missed ones
+	for _, msgJson := range client.outbox.drain() {
+		client.replay.push(msgJson)
+	}
+	missed, ok := client.replay.since(req.seq)
+	if !ok {
+		// the client can not catch up, it should join again
+		client.closeReason = ErrReplayGap.Error()
+		h.unregister(client)
+		return ErrReplayGap
+	}
+	if !client.suspended {
+		// the previous connection is not detected as lost yet
+		close(client.Send)
+	}
+
+	client.connGen++
+	client.suspended = false
+	client.Conn = req.conn
+	client.Send = make(chan []byte, SEND_BUFFER_SIZE)
+	for _, msg := range missed {
+		client.Send <- msg
+	}
+	go client.Read()
+	go client.Write()
+
+	log.Info().
+		Str("uid", client.ID.String()).
+		Str("rid", h.B64ID()).
+		Int("replay", len(missed)).
+		Msg("[hub] client resumed")
+	return nil
+}
+
+// must be called in the hub loop
+func (h *Hub) sendResumeToken(client *Client) {
+	if RESUME_GRACE_PERIOD == 0 {
+		return
+	}
+	msg := DirectMessage[ResumeInfo]{
+		MsgType: MSG_EVENT_ROOM,
+		To:      client.ID,
+		Data: ResumeInfo{
+			Resume: auth.ResumeToken(client.ID, client.Token),
+			Grace:  int(RESUME_GRACE_PERIOD.Seconds()),
+		},
+	}
+	msgJson, err := msg.Json()
+	if err != nil {
+		log.Error().Err(err).Msg("[hub] resume token json encode error")
+		return
+	}
+	h.send(client, msgJson, DELIVERY_ORDERED, "")
+}
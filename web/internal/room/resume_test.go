@@ -0,0 +1,70 @@
+package room
+
+import (
+	"fmt"
+	"testing"
+)
+
+func pushReplay(rb *replayBuffer, n int) {
+	for i := 0; i < n; i++ {
+		rb.push([]byte(fmt.Sprint(rb.seq + 1)))
+	}
+}
+
+func checkReplay(t *testing.T, msgs [][]byte, from uint64) {
+	t.Helper()
+	for i, msg := range msgs {
+		if want := fmt.Sprint(from + uint64(i)); string(msg) != want {
+			t.Fatalf("message %v = %q, want %q", i, msg, want)
+		}
+	}
+}
+
+func TestReplayBufferSince(t *testing.T) {
+	rb := newReplayBuffer()
+	pushReplay(rb, 3)
+
+	msgs, ok := rb.since(0)
+	if !ok || len(msgs) != 3 {
+		t.Fatalf("since(0) = %v messages, %v, want 3, true", len(msgs), ok)
+	}
+	checkReplay(t, msgs, 1)
+
+	msgs, ok = rb.since(2)
+	if !ok || len(msgs) != 1 {
+		t.Fatalf("since(2) = %v messages, %v, want 1, true", len(msgs), ok)
+	}
+	checkReplay(t, msgs, 3)
+
+	// the client has received everything
+	if msgs, ok := rb.since(3); !ok || len(msgs) != 0 {
+		t.Fatalf("since(3) = %v messages, %v, want 0, true", len(msgs), ok)
+	}
+	// the client is ahead of the buffer
+	if _, ok := rb.since(4); ok {
+		t.Fatal("since(4) is ok, the seq is ahead")
+	}
+}
+
+func TestReplayBufferWrap(t *testing.T) {
+	rb := newReplayBuffer()
+	pushReplay(rb, REPLAY_BUFFER_SIZE+10)
+
+	// the whole buffer can be replayed
+	msgs, ok := rb.since(10)
+	if !ok || len(msgs) != REPLAY_BUFFER_SIZE {
+		t.Fatalf("since(10) = %v messages, %v, want %v, true", len(msgs), ok, REPLAY_BUFFER_SIZE)
+	}
+	checkReplay(t, msgs, 11)
+
+	// the message after the seq is overwritten
+	if _, ok := rb.since(9); ok {
+		t.Fatal("since(9) is ok, the message 10 is dropped")
+	}
+
+	msgs, ok = rb.since(REPLAY_BUFFER_SIZE)
+	if !ok || len(msgs) != 10 {
+		t.Fatalf("since(%v) = %v messages, %v, want 10, true", REPLAY_BUFFER_SIZE, len(msgs), ok)
+	}
+	checkReplay(t, msgs, REPLAY_BUFFER_SIZE+1)
+}
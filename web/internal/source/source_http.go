@@ -0,0 +1,181 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"main/internal/ytdlp"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	HTTP_MAX_REDIRECTS = 5
+)
+
+var (
+	ErrForbiddenAddress = errors.New("address is not public")
+
+	// shared address space (RFC 6598), not covered by netip.Addr.IsPrivate()
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+)
+
+// plain audio files over http, matched by the file extension of the url path
+type HTTPSource struct {
+	client *http.Client
+}
+
+// the client only connects to public addresses, the address is checked after the dns resolution
+// such that a url can not reach the server itself or the internal network, including redirects
+func NewHTTPSource() *HTTPSource {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %v", ErrForbiddenAddress, address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be dialed instead of the target
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &HTTPSource{
+		client: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= HTTP_MAX_REDIRECTS {
+					return errors.New("too many redirects")
+				}
+				return checkHost(req.URL)
+			},
+		},
+	}
+}
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// reject the url before connecting if the host is obviously not public
+func checkHost(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme: %v", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %v", ErrForbiddenAddress, host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return fmt.Errorf("%w: %v", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+func (src *HTTPSource) Name() string {
+	return "http"
+}
+
+func (src *HTTPSource) Match(u *url.URL) bool {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	_, ok := AUDIO_EXTENSIONS[strings.ToLower(path.Ext(u.Path))]
+	return ok
+}
+
+// byteRange is set to the Range header if not empty, a partial response is accepted
+func (src *HTTPSource) do(ctx context.Context, method, rawURL, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHost(req.URL); err != nil {
+		return nil, err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := src.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && (byteRange == "" || resp.StatusCode != http.StatusPartialContent) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected http status: %v, url: %v", resp.Status, rawURL)
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		if !strings.HasPrefix(mediaType, "audio/") && mediaType != "application/octet-stream" {
+			resp.Body.Close()
+			return nil, fmt.Errorf("not an audio file, content type: %v", mediaType)
+		}
+	}
+	if resp.ContentLength > MAX_AUDIO_SIZE {
+		resp.Body.Close()
+		return nil, errors.New("audio file is too large")
+	}
+
+	return resp, nil
+}
+
+func (src *HTTPSource) Resolve(ctx context.Context, rawURL string) (ytdlp.InfoJson, error) {
+	resp, err := src.do(ctx, http.MethodHead, rawURL, "")
+	if err != nil {
+		// HEAD is not allowed by some servers, request the first byte instead
+		if errors.Is(err, ErrForbiddenAddress) {
+			return ytdlp.InfoJson{}, err
+		}
+		resp, err = src.do(ctx, http.MethodGet, rawURL, "bytes=0-0")
+		if err != nil {
+			return ytdlp.InfoJson{}, err
+		}
+	}
+	resp.Body.Close()
+
+	u := resp.Request.URL
+	name, err := url.PathUnescape(path.Base(u.Path))
+	if err != nil {
+		name = path.Base(u.Path)
+	}
+	infoJson := ytdlp.InfoJson{
+		FullTitle: strings.TrimSuffix(name, path.Ext(name)),
+		Uploader:  u.Hostname(),
+	}
+
+	return infoJson, nil
+}
+
+func (src *HTTPSource) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	resp, err := src.do(ctx, http.MethodGet, rawURL, "")
+	if err != nil {
+		return []byte{}, err
+	}
+	defer resp.Body.Close()
+
+	audioBytes, err := io.ReadAll(io.LimitReader(resp.Body, MAX_AUDIO_SIZE+1))
+	if err != nil {
+		return []byte{}, err
+	}
+	if len(audioBytes) > MAX_AUDIO_SIZE {
+		return []byte{}, errors.New("audio file is too large")
+	}
+
+	return audioBytes, nil
+}
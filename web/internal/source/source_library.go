@@ -0,0 +1,99 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"main/internal/library"
+	"main/internal/ytdlp"
+	"net/url"
+)
+
+// tracks of the server-side music library, the url is in the form of "library:<id>"
+type LibrarySource struct {
+	lib *library.Library
+}
+
+func NewLibrarySource(lib *library.Library) *LibrarySource {
+	return &LibrarySource{
+		lib: lib,
+	}
+}
+
+func (src *LibrarySource) Name() string {
+	return "library"
+}
+
+func (src *LibrarySource) Match(u *url.URL) bool {
+	return u.Scheme == library.REF_SCHEME
+}
+
+func (src *LibrarySource) track(rawURL string) (library.Track, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		errf := fmt.Errorf("url parse failed, err: %v, url: %v", err, rawURL)
+		return library.Track{}, errf
+	}
+	track, ok := src.lib.Get(u.Opaque)
+	if !ok {
+		return library.Track{}, fmt.Errorf("track not found in library, id: %v", u.Opaque)
+	}
+
+	return track, nil
+}
+
+func (src *LibrarySource) Resolve(ctx context.Context, rawURL string) (ytdlp.InfoJson, error) {
+	track, err := src.track(rawURL)
+	if err != nil {
+		return ytdlp.InfoJson{}, err
+	}
+	infoJson := ytdlp.InfoJson{
+		FullTitle: track.Title,
+		Uploader:  track.Artist,
+		Duration:  track.Duration,
+	}
+
+	return infoJson, nil
+}
+
+func (src *LibrarySource) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	track, err := src.track(rawURL)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return readAudioFile(track.Path)
+}
+
+// the other tracks of the same artist, or the same album if the artist is unknown
+func (src *LibrarySource) Related(ctx context.Context, rawURL string, limit int) ([]ytdlp.SearchResult, error) {
+	track, err := src.track(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	query := track.Artist
+	if query == "" {
+		query = track.Album
+	}
+
+	results := []ytdlp.SearchResult{}
+	for _, t := range src.lib.Search(query, library.SEARCH_MAX_RESULTS) {
+		if t.ID == track.ID {
+			continue
+		}
+		result := ytdlp.SearchResult{
+			ID:  t.ID,
+			URL: t.Ref(),
+			InfoJson: ytdlp.InfoJson{
+				FullTitle: t.Title,
+				Uploader:  t.Artist,
+				Duration:  t.Duration,
+			},
+		}
+		results = append(results, result)
+		if len(results) >= limit {
+			break
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,112 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"main/internal/ytdlp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	LOCAL_SOURCE_DIR = os.Getenv("LOCAL_SOURCE_DIR")
+)
+
+// audio files from a local directory, the url is in the form of "local:<relative path>"
+type LocalSource struct {
+	dir string
+}
+
+func NewLocalSource(dir string) *LocalSource {
+	return &LocalSource{
+		dir: filepath.Clean(dir),
+	}
+}
+
+func (src *LocalSource) Name() string {
+	return "local"
+}
+
+func (src *LocalSource) Match(u *url.URL) bool {
+	return u.Scheme == "local"
+}
+
+// resolve the url to a file path inside the directory
+func (src *LocalSource) path(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		errf := fmt.Errorf("url parse failed, err: %v, url: %v", err, rawURL)
+		return "", errf
+	}
+	rel := u.Opaque
+	if rel == "" {
+		rel = strings.TrimPrefix(u.Path, "/")
+	}
+	rel, err = url.PathUnescape(rel)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.FromSlash(rel)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("path is not inside the local source, path: %v", rel)
+	}
+	if _, ok := AUDIO_EXTENSIONS[strings.ToLower(filepath.Ext(rel))]; !ok {
+		return "", fmt.Errorf("unsupported audio file, path: %v", rel)
+	}
+
+	return filepath.Join(src.dir, rel), nil
+}
+
+func (src *LocalSource) Resolve(ctx context.Context, rawURL string) (ytdlp.InfoJson, error) {
+	path, err := src.path(rawURL)
+	if err != nil {
+		return ytdlp.InfoJson{}, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return ytdlp.InfoJson{}, err
+	}
+	if !stat.Mode().IsRegular() {
+		return ytdlp.InfoJson{}, fmt.Errorf("not a regular file, path: %v", path)
+	}
+
+	name := filepath.Base(path)
+	infoJson := ytdlp.InfoJson{
+		FullTitle: strings.TrimSuffix(name, filepath.Ext(name)),
+		Uploader:  src.Name(),
+	}
+
+	return infoJson, nil
+}
+
+func (src *LocalSource) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	path, err := src.path(rawURL)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return readAudioFile(path)
+}
+
+// read the whole file with the MAX_AUDIO_SIZE limit
+func readAudioFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer f.Close()
+
+	audioBytes, err := io.ReadAll(io.LimitReader(f, MAX_AUDIO_SIZE+1))
+	if err != nil {
+		return []byte{}, err
+	}
+	if len(audioBytes) > MAX_AUDIO_SIZE {
+		return []byte{}, errors.New("audio file is too large")
+	}
+
+	return audioBytes, nil
+}
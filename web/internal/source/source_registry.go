@@ -0,0 +1,151 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/internal/library"
+	"main/internal/upload"
+	"main/internal/ytdlp"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// upper bound of an audio file fetched by the sources
+	MAX_AUDIO_SIZE = 64 << 20
+)
+
+var (
+	// plain audio file extensions which can be served without yt-dlp
+	AUDIO_EXTENSIONS = map[string]string{
+		".aac":  "audio/aac",
+		".flac": "audio/flac",
+		".m4a":  "audio/mp4",
+		".mp3":  "audio/mpeg",
+		".oga":  "audio/ogg",
+		".ogg":  "audio/ogg",
+		".opus": "audio/ogg",
+		".wav":  "audio/wav",
+		".weba": "audio/webm",
+	}
+
+	ErrUnsupportedURL = errors.New("no source supports the url")
+	ErrNoRelated      = errors.New("the source has no related tracks")
+
+	registry = &Registry{}
+)
+
+// Source is an audio backend, it resolves the metadata and fetches the audio of an url.
+// Methods are called by the workers of the ytdlp task queue
+type Source interface {
+	Name() string
+	Match(u *url.URL) bool
+	Resolve(ctx context.Context, rawURL string) (ytdlp.InfoJson, error)
+	Fetch(ctx context.Context, rawURL string) ([]byte, error)
+}
+
+// Recommender is implemented by the sources which can suggest the related tracks of an url
+type Recommender interface {
+	Related(ctx context.Context, rawURL string, limit int) ([]ytdlp.SearchResult, error)
+}
+
+// Registry selects the source of an url, the first matched source is selected
+type Registry struct {
+	sync.RWMutex
+	sources []Source
+}
+
+func (reg *Registry) Register(src Source) {
+	reg.Lock()
+	defer reg.Unlock()
+
+	reg.sources = append(reg.sources, src)
+	log.Info().Str("source", src.Name()).Msg("[source] registered")
+}
+
+func (reg *Registry) Lookup(rawURL string) (Source, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		errf := fmt.Errorf("url parse failed, err: %v, url: %v", err, rawURL)
+		return nil, errf
+	}
+
+	reg.RLock()
+	defer reg.RUnlock()
+	for _, src := range reg.sources {
+		if src.Match(u) {
+			return src, nil
+		}
+	}
+
+	return nil, ErrUnsupportedURL
+}
+
+func Register(src Source) {
+	registry.Register(src)
+}
+
+func Lookup(rawURL string) (Source, error) {
+	return registry.Lookup(rawURL)
+}
+
+// Related returns the related tracks of the url from its source,
+// ErrNoRelated is returned if the source is not a Recommender
+func Related(ctx context.Context, rawURL string, limit int) ([]ytdlp.SearchResult, error) {
+	src, err := Lookup(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	recommender, ok := src.(Recommender)
+	if !ok {
+		return nil, ErrNoRelated
+	}
+
+	return recommender.Related(ctx, rawURL, limit)
+}
+
+// SubmitInfo submits the metadata request with the source selected by the url.
+// The return values are the same as WorkerPool.Submit(),
+// http.StatusBadRequest is returned if no source supports the url
+func SubmitInfo(ctx context.Context, req *ytdlp.RequestInfojson) (int, int64) {
+	src, err := Lookup(req.URL)
+	if err != nil {
+		log.Debug().Err(err).Str("reqURL", req.URL).Msg("[source] lookup failed")
+		return http.StatusBadRequest, -1
+	}
+	req.Resolve = src.Resolve
+
+	return ytdlp.SubmitInfojson(ctx, req)
+}
+
+// SubmitAudio submits the audio request with the source selected by the url.
+// The return values are the same as WorkerPool.Submit(),
+// http.StatusBadRequest is returned if no source supports the url
+func SubmitAudio(ctx context.Context, req *ytdlp.RequestAudio) (int, int64) {
+	src, err := Lookup(req.URL)
+	if err != nil {
+		log.Debug().Err(err).Str("reqURL", req.URL).Msg("[source] lookup failed")
+		return http.StatusBadRequest, -1
+	}
+	req.Fetch = src.Fetch
+
+	return ytdlp.SubmitAudio(ctx, req)
+}
+
+func init() {
+	// order matters, ytdlp accepts any http url and should be the last one
+	Register(NewUploadSource(upload.Default))
+	if library.Default != nil {
+		Register(NewLibrarySource(library.Default))
+	}
+	if LOCAL_SOURCE_DIR != "" {
+		Register(NewLocalSource(LOCAL_SOURCE_DIR))
+	}
+	Register(NewHTTPSource())
+	Register(NewYtdlpSource())
+}
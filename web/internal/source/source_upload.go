@@ -0,0 +1,65 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"main/internal/upload"
+	"main/internal/ytdlp"
+	"net/url"
+)
+
+// audio files uploaded by the users, the url is in the form of "upload:<id>"
+type UploadSource struct {
+	store *upload.Store
+}
+
+func NewUploadSource(store *upload.Store) *UploadSource {
+	return &UploadSource{
+		store: store,
+	}
+}
+
+func (src *UploadSource) Name() string {
+	return "upload"
+}
+
+func (src *UploadSource) Match(u *url.URL) bool {
+	return u.Scheme == upload.REF_SCHEME
+}
+
+func (src *UploadSource) file(rawURL string) (upload.File, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		errf := fmt.Errorf("url parse failed, err: %v, url: %v", err, rawURL)
+		return upload.File{}, errf
+	}
+	f, ok := src.store.Get(u.Opaque)
+	if !ok {
+		return upload.File{}, fmt.Errorf("uploaded file not found, id: %v", u.Opaque)
+	}
+
+	return f, nil
+}
+
+func (src *UploadSource) Resolve(ctx context.Context, rawURL string) (ytdlp.InfoJson, error) {
+	f, err := src.file(rawURL)
+	if err != nil {
+		return ytdlp.InfoJson{}, err
+	}
+	infoJson := ytdlp.InfoJson{
+		FullTitle: f.Tags.Title,
+		Uploader:  f.Tags.Artist,
+		Duration:  f.Tags.Duration,
+	}
+
+	return infoJson, nil
+}
+
+func (src *UploadSource) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	f, err := src.file(rawURL)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return readAudioFile(f.Path)
+}
@@ -0,0 +1,58 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"main/internal/ytdlp"
+	"net/http"
+	"net/url"
+)
+
+// the embedded yt-dlp over the unix socket, accepts any http url
+type YtdlpSource struct{}
+
+func NewYtdlpSource() *YtdlpSource {
+	return &YtdlpSource{}
+}
+
+func (src *YtdlpSource) Name() string {
+	return "ytdlp"
+}
+
+func (src *YtdlpSource) Match(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (src *YtdlpSource) Resolve(ctx context.Context, rawURL string) (ytdlp.InfoJson, error) {
+	return ytdlp.DownloadInfoJson(ctx, rawURL)
+}
+
+func (src *YtdlpSource) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	return ytdlp.DownloadAudio(ctx, rawURL)
+}
+
+// the related tracks are searched by the json workers, it blocks until the result is ready
+func (src *YtdlpSource) Related(ctx context.Context, rawURL string, limit int) ([]ytdlp.SearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, ytdlp.TIMEOUT_SEARCH)
+	defer cancel()
+	req := ytdlp.RequestSearch{
+		Ctx:     ctx,
+		Query:   rawURL,
+		Limit:   limit,
+		Related: true,
+		ErrCh:   make(chan error),
+		FinCh:   make(chan struct{}),
+	}
+	if status, _ := ytdlp.JsonDownloader.Submit(ctx, &req); status != http.StatusAccepted {
+		return nil, fmt.Errorf("failed to submit related request, status: %v", status)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case err := <-req.ErrCh:
+		return nil, err
+	case <-req.FinCh:
+		return req.Response, nil
+	}
+}
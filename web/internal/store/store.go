@@ -0,0 +1,113 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// directory of the persistent data, the data is kept in memory only if it is not set
+	DATA_DIR = os.Getenv("DATA_DIR")
+
+	Default = New(DATA_DIR)
+)
+
+// Store persists json documents as files in a directory,
+// a document is written to a temp file and renamed to replace the old one
+type Store struct {
+	sync.Mutex
+	dir string
+	mem map[string][]byte
+}
+
+func New(dir string) *Store {
+	if dir == "" {
+		log.Warn().Msg("DATA_DIR is not set, the data is lost on restart")
+	} else if err := os.MkdirAll(dir, 0o750); err != nil {
+		log.Error().Err(err).Str("dir", dir).Msg("[store] failed to create data dir, the data is lost on restart")
+		dir = ""
+	}
+
+	return &Store{
+		dir: dir,
+		mem: make(map[string][]byte),
+	}
+}
+
+func (s *Store) path(name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid document name: %v", name)
+	}
+	return filepath.Join(s.dir, name+".json"), nil
+}
+
+// Load decodes the document into v, v is untouched if the document does not exist
+func (s *Store) Load(name string, v any) error {
+	s.Lock()
+	defer s.Unlock()
+
+	var data []byte
+	if s.dir == "" {
+		data = s.mem[name]
+	} else {
+		path, err := s.path(name)
+		if err != nil {
+			return err
+		}
+		data, err = os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func (s *Store) Save(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("json marshal error, err: %v", err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.dir == "" {
+		s.mem[name] = data
+		return nil
+	}
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
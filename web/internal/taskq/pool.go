@@ -128,3 +128,9 @@ func (wp *WorkerPool) Submit(ctx context.Context, t Task) (int, int64) {
 		return http.StatusTooManyRequests, -1
 	}
 }
+
+// generate a task ID for a task which is not submitted to the queue,
+// e.g. a task attached to another in-flight task
+func (wp *WorkerPool) NewTaskID() int64 {
+	return wp.snowflakeNode.Generate().Int64()
+}
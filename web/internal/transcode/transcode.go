@@ -0,0 +1,194 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Quality string
+
+const (
+	QUALITY_ORIGINAL Quality = "original"
+	QUALITY_LOW      Quality = "low"
+	QUALITY_MEDIUM   Quality = "medium"
+	QUALITY_HIGH     Quality = "high"
+)
+
+type Rendition struct {
+	Quality     Quality
+	Codec       string // ffmpeg encoder
+	Bitrate     string
+	Format      string // ffmpeg muxer
+	ContentType string
+}
+
+var (
+	FFMPEG_PATH = func() string {
+		path := os.Getenv("FFMPEG_PATH")
+		if path == "" {
+			path = "ffmpeg"
+		}
+		return path
+	}()
+
+	// transcoding is disabled if ffmpeg is not found
+	Enabled = func() bool {
+		if _, err := exec.LookPath(FFMPEG_PATH); err != nil {
+			log.Warn().Err(err).Msg("ffmpeg not found, transcoding is disabled")
+			return false
+		}
+		return true
+	}()
+
+	MAX_CONCURRENT_TRANSCODE = func() int {
+		envar := os.Getenv("MAX_CONCURRENT_TRANSCODE")
+		if envar == "" {
+			return 2
+		}
+		ret, err := strconv.Atoi(envar)
+		if err != nil || ret <= 0 {
+			log.Error().Err(err).Msg("Invalid env: MAX_CONCURRENT_TRANSCODE")
+			return 2
+		}
+		return ret
+	}()
+
+	// limit the ffmpeg processes of the server
+	semaphore = make(chan struct{}, MAX_CONCURRENT_TRANSCODE)
+
+	// bitrate ladder, from low to high
+	Ladder = []Rendition{
+		{Quality: QUALITY_LOW, Codec: "libopus", Bitrate: "48k", Format: "webm", ContentType: "audio/webm"},
+		{Quality: QUALITY_MEDIUM, Codec: "libopus", Bitrate: "96k", Format: "webm", ContentType: "audio/webm"},
+		{Quality: QUALITY_HIGH, Codec: "libopus", Bitrate: "160k", Format: "webm", ContentType: "audio/webm"},
+	}
+)
+
+func ParseQuality(s string) (Quality, bool) {
+	if Quality(s) == QUALITY_ORIGINAL {
+		return QUALITY_ORIGINAL, true
+	}
+	for _, rend := range Ladder {
+		if Quality(s) == rend.Quality {
+			return rend.Quality, true
+		}
+	}
+	return "", false
+}
+
+// run ffmpeg with the input piped to stdin, and returns stdout
+func ffmpeg(ctx context.Context, input []byte, args ...string) ([]byte, error) {
+	args = append([]string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}, args...)
+	stdout, _, err := runFFmpeg(ctx, input, args...)
+	return stdout, err
+}
+
+// run ffmpeg with the full arguments, and returns stdout and stderr
+func runFFmpeg(ctx context.Context, input []byte, args ...string) ([]byte, []byte, error) {
+	select {
+	case semaphore <- struct{}{}:
+		defer func() { <-semaphore }()
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	cmd := exec.CommandContext(ctx, FFMPEG_PATH, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		errf := fmt.Errorf("ffmpeg error, err: %v, stderr: %v", err, stderr.String())
+		return nil, nil, errf
+	}
+
+	return stdout.Bytes(), stderr.Bytes(), nil
+}
+
+func Transcode(ctx context.Context, input []byte, rend Rendition) ([]byte, error) {
+	return ffmpeg(ctx, input,
+		"-vn",
+		"-c:a", rend.Codec,
+		"-b:a", rend.Bitrate,
+		"-f", rend.Format,
+		"pipe:1",
+	)
+}
+
+// the rendition of the quality, the highest rendition is returned for QUALITY_ORIGINAL
+func LadderRendition(q Quality) Rendition {
+	for _, rend := range Ladder {
+		if rend.Quality == q {
+			return rend
+		}
+	}
+	return Ladder[len(Ladder)-1]
+}
+
+// Renditions of an audio, a rendition is transcoded on its first request and kept
+type Renditions struct {
+	audio map[Quality]*task[[]byte]
+}
+
+// NewRenditions prepares the renditions of the ladder, nothing is transcoded until it is requested.
+// The transcoding runs under ctx, it is not cancelled by the requesting callers
+func NewRenditions(ctx context.Context, input []byte) *Renditions {
+	rends := &Renditions{
+		audio: make(map[Quality]*task[[]byte]),
+	}
+	if !Enabled || len(input) == 0 {
+		return rends
+	}
+	for _, rend := range Ladder {
+		rends.audio[rend.Quality] = newTask(ctx, func(ctx context.Context) ([]byte, error) {
+			audio, err := Transcode(ctx, input, rend)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Error().Err(err).Str("quality", string(rend.Quality)).Msg("[transcode] failed")
+				}
+				return nil, err
+			}
+			log.Debug().Str("quality", string(rend.Quality)).Int("size", len(audio)).Msg("[transcode] rendition ready")
+			return audio, nil
+		})
+	}
+
+	return rends
+}
+
+// Get returns the rendition if it is ready, otherwise the transcoding is started and ok is false
+func (rends *Renditions) Get(q Quality) ([]byte, Rendition, bool) {
+	if rends == nil {
+		return nil, Rendition{}, false
+	}
+	t, ok := rends.audio[q]
+	if !ok {
+		return nil, Rendition{}, false
+	}
+	t.start()
+	audio, ok := t.result()
+	if !ok {
+		return nil, Rendition{}, false
+	}
+	return audio, LadderRendition(q), true
+}
+
+// the qualities which can be served, the renditions are transcoded on request
+func (rends *Renditions) Qualities() []Quality {
+	ret := []Quality{QUALITY_ORIGINAL}
+	if rends == nil {
+		return ret
+	}
+	for _, rend := range Ladder {
+		if _, ok := rends.audio[rend.Quality]; ok {
+			ret = append(ret, rend.Quality)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,193 @@
+package transcode
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	HLS_PLAYLIST        = "index.m3u8"
+	HLS_MASTER_PLAYLIST = "master.m3u8"
+	HLS_SEGMENT_SECONDS = 4
+	HLS_CODEC           = "aac"
+	HLS_CODEC_TAG       = "mp4a.40.2" // AAC-LC, the CODECS attribute of the master playlist
+
+	// the variant served without a quality in the url
+	HLS_DEFAULT_QUALITY = QUALITY_MEDIUM
+)
+
+type HLSVariant struct {
+	Quality   Quality
+	Bitrate   string // ffmpeg bitrate
+	Bandwidth int    // bps, including the mpegts overhead
+}
+
+var (
+	ErrHLSDisabled = errors.New("hls is not available without ffmpeg")
+
+	// every variant is segmented at the same boundaries,
+	// a client can switch the variant at any segment without losing the position of the track
+	HLSLadder = []HLSVariant{
+		{Quality: QUALITY_LOW, Bitrate: "64k", Bandwidth: 72000},
+		{Quality: QUALITY_MEDIUM, Bitrate: "128k", Bandwidth: 140000},
+		{Quality: QUALITY_HIGH, Bitrate: "192k", Bandwidth: 210000},
+	}
+)
+
+// HLSVariants are the HLS renditions of an audio, each variant is segmented on its first request
+type HLSVariants struct {
+	variants map[Quality]*HLS
+}
+
+// NewHLSVariants prepares the variants of HLSLadder, nothing is done until a variant is requested
+func NewHLSVariants(ctx context.Context, input []byte) *HLSVariants {
+	v := &HLSVariants{
+		variants: make(map[Quality]*HLS),
+	}
+	for _, variant := range HLSLadder {
+		v.variants[variant.Quality] = NewHLS(ctx, input, variant)
+	}
+	return v
+}
+
+func (v *HLSVariants) Variant(q Quality) (*HLS, bool) {
+	if v == nil {
+		return nil, false
+	}
+	hls, ok := v.variants[q]
+	return hls, ok
+}
+
+// Master returns the multivariant playlist, the query is appended to every variant URI
+func (v *HLSVariants) Master(query string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString("#EXT-X-VERSION:3\n")
+	buf.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, variant := range HLSLadder {
+		fmt.Fprintf(&buf, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"%s\"\n", variant.Bandwidth, HLS_CODEC_TAG)
+		buf.WriteString(string(variant.Quality) + "/" + HLS_PLAYLIST)
+		if query != "" {
+			buf.WriteString("?" + query)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// HLS is an audio split into segments with a VOD playlist, the audio is segmented on the first Wait()
+type HLS struct {
+	task *task[hlsFiles]
+}
+
+type hlsFiles struct {
+	playlist []byte
+	segments map[string][]byte // file name -> segment
+}
+
+// NewHLS prepares the segmentation of the audio, nothing is done until it is requested.
+// The segmentation runs under ctx, it is not cancelled by the requesting callers
+func NewHLS(ctx context.Context, input []byte, variant HLSVariant) *HLS {
+	return &HLS{
+		task: newTask(ctx, func(ctx context.Context) (hlsFiles, error) {
+			if !Enabled || len(input) == 0 {
+				return hlsFiles{}, ErrHLSDisabled
+			}
+			files, err := segment(ctx, input, variant)
+			if err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msg("[transcode] hls failed")
+			}
+			return files, err
+		}),
+	}
+}
+
+func segment(ctx context.Context, input []byte, variant HLSVariant) (hlsFiles, error) {
+	dir, err := os.MkdirTemp("", "jukebox-hls-")
+	if err != nil {
+		return hlsFiles{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = ffmpeg(ctx, input,
+		"-vn",
+		"-c:a", HLS_CODEC,
+		"-b:a", variant.Bitrate,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(HLS_SEGMENT_SECONDS),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_type", "mpegts",
+		"-hls_segment_filename", filepath.Join(dir, "seg%d.ts"),
+		filepath.Join(dir, HLS_PLAYLIST),
+	)
+	if err != nil {
+		return hlsFiles{}, err
+	}
+
+	playlist, err := os.ReadFile(filepath.Join(dir, HLS_PLAYLIST))
+	if err != nil {
+		return hlsFiles{}, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return hlsFiles{}, err
+	}
+	files := hlsFiles{
+		playlist: playlist,
+		segments: make(map[string][]byte),
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if filepath.Ext(name) != ".ts" {
+			continue
+		}
+		segment, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return hlsFiles{}, err
+		}
+		files.segments[name] = segment
+	}
+
+	return files, nil
+}
+
+// Wait segments the audio if it is not yet started, and blocks until the segments are ready
+func (hls *HLS) Wait(ctx context.Context) error {
+	if hls == nil {
+		return ErrHLSDisabled
+	}
+	_, err := hls.task.Wait(ctx)
+	return err
+}
+
+// Playlist returns the playlist with the query appended to every segment URI,
+// must be called after Wait()
+func (hls *HLS) Playlist(query string) []byte {
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(hls.task.val.playlist))
+	for scanner.Scan() {
+		line := scanner.Text()
+		buf.WriteString(line)
+		if query != "" && len(line) > 0 && !strings.HasPrefix(line, "#") {
+			buf.WriteString("?")
+			buf.WriteString(query)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// Segment returns the segment by its file name, must be called after Wait()
+func (hls *HLS) Segment(name string) ([]byte, bool) {
+	segment, ok := hls.task.val.segments[name]
+	return segment, ok
+}
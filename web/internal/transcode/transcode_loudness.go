@@ -0,0 +1,136 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// integrated loudness target in LUFS, EBU R128
+	LOUDNESS_TARGET = -14.0
+
+	// bound of the normalization gain in dB
+	LOUDNESS_MIN_GAIN = -20.0
+	LOUDNESS_MAX_GAIN = 12.0
+)
+
+var (
+	ErrLoudnessDisabled = errors.New("loudness is not available without ffmpeg")
+)
+
+// Loudness is the integrated loudness of an audio, measured on demand
+type Loudness struct {
+	measured   *task[float64]
+	Integrated float64 // LUFS, set once measured
+	Gain       float64 // dB to reach LOUDNESS_TARGET, set once measured
+
+	// normalized audio served by the server, encoded once on demand under ctx
+	ctx context.Context
+	sync.Mutex
+	normalized map[Quality]*task[[]byte]
+}
+
+// NewLoudness measures the audio on the first Wait() or Start(), under ctx.
+// Nothing is measured if the loudness is never requested
+func NewLoudness(ctx context.Context, input []byte) *Loudness {
+	loudness := &Loudness{
+		ctx:        ctx,
+		normalized: make(map[Quality]*task[[]byte]),
+	}
+	loudness.measured = newTask(ctx, func(ctx context.Context) (float64, error) {
+		if !Enabled || len(input) == 0 {
+			return 0, ErrLoudnessDisabled
+		}
+		integrated, err := measure(ctx, input)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error().Err(err).Msg("[transcode] loudness measurement failed")
+			}
+			return 0, err
+		}
+		loudness.Integrated = integrated
+		loudness.Gain = math.Max(LOUDNESS_MIN_GAIN, math.Min(LOUDNESS_MAX_GAIN, LOUDNESS_TARGET-integrated))
+		log.Debug().Float64("lufs", integrated).Float64("gain", loudness.Gain).Msg("[transcode] loudness measured")
+		return integrated, nil
+	})
+
+	return loudness
+}
+
+// run the loudnorm filter in analysis mode, it prints the measurement in json to stderr
+func measure(ctx context.Context, input []byte) (float64, error) {
+	_, stderr, err := runFFmpeg(ctx, input,
+		"-hide_banner", "-nostats",
+		"-i", "pipe:0",
+		"-vn",
+		"-af", fmt.Sprintf("loudnorm=I=%v:print_format=json", LOUDNESS_TARGET),
+		"-f", "null", "-",
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	start := bytes.LastIndexByte(stderr, '{')
+	end := bytes.LastIndexByte(stderr, '}')
+	if start < 0 || end < start {
+		return 0, errors.New("loudnorm output not found")
+	}
+	var output struct {
+		InputI string `json:"input_i"`
+	}
+	if err := json.Unmarshal(stderr[start:end+1], &output); err != nil {
+		return 0, err
+	}
+	integrated, err := strconv.ParseFloat(output.InputI, 64)
+	if err != nil || math.IsInf(integrated, 0) || math.IsNaN(integrated) {
+		// silence is measured as -inf
+		return 0, fmt.Errorf("invalid integrated loudness: %v", output.InputI)
+	}
+
+	return integrated, nil
+}
+
+// Wait starts the measurement if it is not started yet, and blocks until it is finished
+func (loudness *Loudness) Wait(ctx context.Context) error {
+	if loudness == nil {
+		return ErrLoudnessDisabled
+	}
+	_, err := loudness.measured.Wait(ctx)
+	return err
+}
+
+// Normalized returns the audio with the gain applied, encoded as the rendition of the quality.
+// The audio is encoded once for all callers and cached, ctx only stops the caller from waiting.
+// Must be called after Wait()
+func (loudness *Loudness) Normalized(ctx context.Context, input []byte, q Quality) ([]byte, Rendition, error) {
+	rend := LadderRendition(q)
+
+	loudness.Lock()
+	t, ok := loudness.normalized[rend.Quality]
+	if !ok {
+		gain := loudness.Gain
+		t = newTask(loudness.ctx, func(ctx context.Context) ([]byte, error) {
+			return ffmpeg(ctx, input,
+				"-vn",
+				"-af", fmt.Sprintf("volume=%.2fdB,alimiter=limit=0.89", gain),
+				"-c:a", rend.Codec,
+				"-b:a", rend.Bitrate,
+				"-f", rend.Format,
+				"pipe:1",
+			)
+		})
+		loudness.normalized[rend.Quality] = t
+	}
+	loudness.Unlock()
+
+	audio, err := t.Wait(ctx)
+	return audio, rend, err
+}
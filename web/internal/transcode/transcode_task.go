@@ -0,0 +1,57 @@
+package transcode
+
+import (
+	"context"
+	"sync"
+)
+
+// task runs the function once, on the first Wait(), under the context given at creation.
+// The callers only stop waiting when their own context is done, the task keeps running for the others
+type task[T any] struct {
+	ctx  context.Context
+	fn   func(context.Context) (T, error)
+	once sync.Once
+	done chan struct{}
+	val  T
+	err  error
+}
+
+func newTask[T any](ctx context.Context, fn func(context.Context) (T, error)) *task[T] {
+	return &task[T]{
+		ctx:  ctx,
+		fn:   fn,
+		done: make(chan struct{}),
+	}
+}
+
+// start the task if it is not started yet, without waiting
+func (t *task[T]) start() {
+	t.once.Do(func() {
+		go func() {
+			defer close(t.done)
+			t.val, t.err = t.fn(t.ctx)
+		}()
+	})
+}
+
+// returns the value if the task has finished without error, it does not start the task
+func (t *task[T]) result() (T, bool) {
+	select {
+	case <-t.done:
+		return t.val, t.err == nil
+	default:
+		var zero T
+		return zero, false
+	}
+}
+
+func (t *task[T]) Wait(ctx context.Context) (T, error) {
+	t.start()
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case <-t.done:
+		return t.val, t.err
+	}
+}
@@ -0,0 +1,209 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"main/internal/library"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// upload reference accepted by the sources, "upload:<id>"
+	REF_SCHEME = "upload"
+
+	MAX_UPLOAD_SIZE = 32 << 20
+
+	// uploaded files are removed after this duration, unless they are still queued
+	UPLOAD_TTL = 6 * time.Hour
+)
+
+var (
+	UPLOAD_DIR = func() string {
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "jukebox", "uploads")
+		}
+		return dir
+	}()
+
+	Default = New(UPLOAD_DIR)
+
+	ErrTooLarge    = errors.New("uploaded file is too large")
+	ErrUnsupported = errors.New("unsupported audio file")
+	ErrNotFound    = errors.New("uploaded file not found")
+	ErrOtherRoom   = errors.New("uploaded file belongs to another room")
+)
+
+type File struct {
+	ID      string
+	Name    string // original file name
+	Path    string
+	Tags    library.Tags
+	RID     uuid.UUID // the room of the uploader, the file can only be queued in it
+	Created time.Time
+
+	refs int // nodes referencing the file, it is not removed while referenced
+}
+
+func (f *File) Ref() string {
+	return REF_SCHEME + ":" + f.ID
+}
+
+// Store keeps the uploaded audio files on disk
+type Store struct {
+	sync.RWMutex
+	dir   string
+	files map[string]*File // id -> file
+}
+
+func New(dir string) *Store {
+	return &Store{
+		dir:   filepath.Clean(dir),
+		files: make(map[string]*File),
+	}
+}
+
+// Save streams the file to disk for the room, the file is rejected if it exceeds MAX_UPLOAD_SIZE,
+// or its audio format is not recognized
+func (s *Store) Save(r io.Reader, name string, rid uuid.UUID) (File, error) {
+	name = filepath.Base(strings.TrimSpace(name))
+	if !library.Supported(name) {
+		return File{}, ErrUnsupported
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return File{}, err
+	}
+
+	id := uuid.New().String()
+	path := filepath.Join(s.dir, id+strings.ToLower(filepath.Ext(name)))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return File{}, err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, MAX_UPLOAD_SIZE+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > MAX_UPLOAD_SIZE {
+		err = ErrTooLarge
+	}
+	if err != nil {
+		os.Remove(path)
+		return File{}, err
+	}
+
+	// probe the metadata, this also validates the audio format
+	tags, err := library.ReadTags(path)
+	if err != nil {
+		os.Remove(path)
+		log.Debug().Err(err).Str("name", name).Msg("[upload] failed to read tags")
+		return File{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if tags.Title == "" {
+		tags.Title = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	file := &File{
+		ID:      id,
+		Name:    name,
+		Path:    path,
+		Tags:    tags,
+		RID:     rid,
+		Created: time.Now(),
+	}
+	s.Lock()
+	s.files[id] = file
+	s.Unlock()
+
+	return *file, nil
+}
+
+func (s *Store) Get(id string) (File, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	f, ok := s.files[id]
+	if !ok {
+		return File{}, false
+	}
+	return *f, true
+}
+
+// the file id of an upload reference, ok is false if ref is not an upload
+func refID(ref string) (string, bool) {
+	return strings.CutPrefix(ref, REF_SCHEME+":")
+}
+
+// Pin marks the file of the reference as used by a node of the room, it is not removed until Unpin().
+// A reference which is not an upload is ignored
+func (s *Store) Pin(ref string, rid uuid.UUID) error {
+	id, ok := refID(ref)
+	if !ok {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	f, ok := s.files[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if f.RID != rid {
+		return ErrOtherRoom
+	}
+	f.refs++
+	return nil
+}
+
+func (s *Store) Unpin(ref string) {
+	id, ok := refID(ref)
+	if !ok {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	if f, ok := s.files[id]; ok && f.refs > 0 {
+		f.refs--
+	}
+}
+
+// Run removes the expired files periodically
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(UPLOAD_TTL / 6)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.removeExpired()
+		}
+	}
+}
+
+func (s *Store) removeExpired() {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, f := range s.files {
+		if f.refs > 0 || time.Since(f.Created) < UPLOAD_TTL {
+			continue
+		}
+		if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Err(err).Str("path", f.Path).Msg("[upload] failed to remove file")
+			continue
+		}
+		delete(s.files, id)
+	}
+}
@@ -59,8 +59,16 @@ func connectUDS(ctx context.Context, endpoint string) (*net.UnixConn, error) {
 }
 
 type RPCInfoJsonRequest struct {
-	Type string
-	URL  string
+	Type  string
+	URL   string
+	Limit int `json:",omitempty"`
+}
+
+// an entry of the "ytsearch" or related results
+type SearchResult struct {
+	ID  string
+	URL string
+	InfoJson
 }
 
 func DownloadInfoJson(ctx context.Context, rawURL string) (InfoJson, error) {
@@ -143,3 +151,64 @@ func DownloadAudio(ctx context.Context, rawURL string) ([]byte, error) {
 
 	return audioBytes, nil
 }
+
+func DownloadSearch(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	request := RPCInfoJsonRequest{
+		Type:  "search",
+		URL:   query,
+		Limit: limit,
+	}
+	return downloadResults(ctx, request)
+}
+
+// the related tracks of the url, ytdlpy responds an empty list if the site has no related results
+func DownloadRelated(ctx context.Context, rawURL string, limit int) ([]SearchResult, error) {
+	if _, err := url.Parse(rawURL); err != nil {
+		errf := fmt.Errorf("url parse failed, err: %v, url: %v", err, rawURL)
+		return []SearchResult{}, errf
+	}
+
+	request := RPCInfoJsonRequest{
+		Type:  "related",
+		URL:   rawURL,
+		Limit: limit,
+	}
+	return downloadResults(ctx, request)
+}
+
+func downloadResults(ctx context.Context, request RPCInfoJsonRequest) ([]SearchResult, error) {
+	conn, err := connectUDS(ctx, YTDLPY_SOCKET_PATH)
+	if err != nil {
+		return []SearchResult{}, err
+	}
+	defer conn.Close()
+
+	requestJson, err := json.Marshal(request)
+	if err != nil {
+		errf := fmt.Errorf("requestJson parse error, err: %v, %v: %v", err, request.Type, request.URL)
+		return []SearchResult{}, errf
+	}
+	conn.Write(requestJson)
+	conn.CloseWrite()
+
+	jsonBytes, err := io.ReadAll(conn)
+	if err != nil {
+		errf := fmt.Errorf("[UDS] read error, err:%v", err)
+		return []SearchResult{}, errf
+	}
+	log.Debug().Bytes("jsonBytes", jsonBytes).Msg("[UDS] recv: ")
+
+	// ytdlpy responds an object on error
+	errJson := InfoJson{}
+	if err := json.Unmarshal(jsonBytes, &errJson); err == nil {
+		errf := fmt.Errorf("ytdlpy error: %v", errJson.Err)
+		return []SearchResult{}, errf
+	}
+	results := []SearchResult{}
+	if err := json.Unmarshal(jsonBytes, &results); err != nil {
+		errf := fmt.Errorf("json unmarshal error, err: %v", err)
+		return []SearchResult{}, errf
+	}
+
+	return results, nil
+}
@@ -0,0 +1,213 @@
+package ytdlp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+/*
+	In-flight request coalescing
+
+	Identical requests submitted while a task of the same resource is still
+	running will not be submitted to the worker pool again, they are attached
+	to the running task and recieve the result on their own channels.
+	The task runs under a context detached from the request which submitted it,
+	it is cancelled only when every attached request has given up
+*/
+
+var (
+	jsonFlight  = newFlightGroup[*RequestInfojson](TIMEOUT_JSON)
+	audioFlight = newFlightGroup[*RequestAudio](TIMEOUT_AUDIO)
+)
+
+// the shared task of a resource
+type flight[R comparable] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// requests waiting for the result -> stop the leave callback
+	waiters map[R]func() bool
+}
+
+type flightGroup[R comparable] struct {
+	sync.Mutex
+	timeout time.Duration
+	// canonical url -> in-flight task
+	calls map[string]*flight[R]
+}
+
+func newFlightGroup[R comparable](timeout time.Duration) *flightGroup[R] {
+	return &flightGroup[R]{
+		timeout: timeout,
+		calls:   make(map[string]*flight[R]),
+	}
+}
+
+// attach the request to the in-flight task of the key, or start a new one.
+// Returns true if the request is the first one and should submit the task
+func (g *flightGroup[R]) acquire(key string, r R, rctx context.Context) (*flight[R], bool) {
+	g.Lock()
+	defer g.Unlock()
+
+	f, ok := g.calls[key]
+	leader := !ok || f.ctx.Err() != nil
+	if leader {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(rctx), g.timeout)
+		f = &flight[R]{
+			ctx:     ctx,
+			cancel:  cancel,
+			waiters: make(map[R]func() bool),
+		}
+		g.calls[key] = f
+	}
+	f.waiters[r] = context.AfterFunc(rctx, func() {
+		g.leave(f, r)
+	})
+
+	return f, leader
+}
+
+// the request has given up, the task is cancelled if nobody is waiting
+func (g *flightGroup[R]) leave(f *flight[R], r R) {
+	g.Lock()
+	defer g.Unlock()
+
+	if _, ok := f.waiters[r]; !ok {
+		return
+	}
+	delete(f.waiters, r)
+	if len(f.waiters) == 0 {
+		f.cancel()
+	}
+}
+
+// remove the task and return the requests waiting for the result
+func (g *flightGroup[R]) finish(key string, f *flight[R]) []R {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.calls[key] == f {
+		delete(g.calls, key)
+	}
+	waiters := make([]R, 0, len(f.waiters))
+	for r, stop := range f.waiters {
+		stop()
+		waiters = append(waiters, r)
+	}
+	f.waiters = nil
+	f.cancel()
+
+	return waiters
+}
+
+// SubmitInfojson submits the request to JsonDownloader,
+// or attaches it to an in-flight request of the same resource.
+// The return values are the same as WorkerPool.Submit()
+func SubmitInfojson(ctx context.Context, req *RequestInfojson) (int, int64) {
+	req.key = CanonicalURL(req.URL)
+	f, leader := jsonFlight.acquire(req.key, req, req.Ctx)
+	if !leader {
+		log.Debug().Str("key", req.key).Msg("[task] infojson request joined in-flight task")
+		return http.StatusAccepted, JsonDownloader.NewTaskID()
+	}
+
+	req.flight = f
+	status, taskID := JsonDownloader.Submit(ctx, req)
+	if status != http.StatusAccepted {
+		// the requests attached in the meantime have been accepted
+		err := fmt.Errorf("failed to submit infojson task, status: %v", status)
+		for _, waiter := range jsonFlight.finish(req.key, f) {
+			if waiter != req {
+				go waiter.resolve(InfoJson{}, err)
+			}
+		}
+	}
+	return status, taskID
+}
+
+// SubmitAudio submits the request to AudioDownloader,
+// or attaches it to an in-flight request of the same resource.
+// The return values are the same as WorkerPool.Submit()
+func SubmitAudio(ctx context.Context, req *RequestAudio) (int, int64) {
+	req.key = CanonicalURL(req.URL)
+	f, leader := audioFlight.acquire(req.key, req, req.Ctx)
+	if !leader {
+		log.Debug().Str("key", req.key).Msg("[task] audio request joined in-flight task")
+		return http.StatusAccepted, AudioDownloader.NewTaskID()
+	}
+
+	req.flight = f
+	status, taskID := AudioDownloader.Submit(ctx, req)
+	if status != http.StatusAccepted {
+		// the requests attached in the meantime have been accepted
+		err := fmt.Errorf("failed to submit audio task, status: %v", status)
+		for _, waiter := range audioFlight.finish(req.key, f) {
+			if waiter != req {
+				go waiter.resolve(nil, err)
+			}
+		}
+	}
+	return status, taskID
+}
+
+// CanonicalURL normalizes the URL such that the same resource maps to the same key,
+// e.g. "https://youtu.be/<id>" and "https://www.youtube.com/watch?v=<id>&t=1"
+func CanonicalURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	host = strings.TrimPrefix(host, "m.")
+	host = strings.TrimPrefix(host, "music.")
+
+	// youtube video id
+	switch host {
+	case "youtu.be":
+		if id := strings.Trim(u.Path, "/"); id != "" {
+			return "youtube:" + id
+		}
+	case "youtube.com":
+		if id := u.Query().Get("v"); id != "" && u.Path == "/watch" {
+			return "youtube:" + id
+		}
+		if id, ok := strings.CutPrefix(u.Path, "/shorts/"); ok && id != "" {
+			return "youtube:" + strings.Trim(id, "/")
+		}
+	}
+
+	// generic url, ignore the fragment and the order of query
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(host)
+	sb.WriteString(strings.TrimSuffix(u.EscapedPath(), "/"))
+	for i, k := range keys {
+		if i == 0 {
+			sb.WriteByte('?')
+		} else {
+			sb.WriteByte('&')
+		}
+		values := query[k]
+		sort.Strings(values)
+		sb.WriteString(url.QueryEscape(k))
+		sb.WriteByte('=')
+		sb.WriteString(url.QueryEscape(strings.Join(values, ",")))
+	}
+
+	return sb.String()
+}
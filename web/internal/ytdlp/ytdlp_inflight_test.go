@@ -0,0 +1,126 @@
+package ytdlp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testRequest struct{ id int }
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"https://youtu.be/abc", "https://www.youtube.com/watch?v=abc&t=1"},
+		{"https://music.youtube.com/watch?v=abc", "https://m.youtube.com/watch?v=abc"},
+		{"https://www.youtube.com/shorts/abc/", "https://youtu.be/abc"},
+		{"https://example.com/a.mp3?x=1&y=2", "https://EXAMPLE.com/a.mp3?y=2&x=1#frag"},
+	}
+	for _, tt := range tests {
+		if CanonicalURL(tt.a) != CanonicalURL(tt.b) {
+			t.Errorf("CanonicalURL(%q) = %q, CanonicalURL(%q) = %q", tt.a, CanonicalURL(tt.a), tt.b, CanonicalURL(tt.b))
+		}
+	}
+	if CanonicalURL("https://youtu.be/abc") == CanonicalURL("https://youtu.be/abd") {
+		t.Error("different videos have the same key")
+	}
+}
+
+func TestFlightGroupAcquire(t *testing.T) {
+	g := newFlightGroup[*testRequest](time.Minute)
+	r1, r2, r3 := &testRequest{1}, &testRequest{2}, &testRequest{3}
+
+	f1, leader := g.acquire("a", r1, context.Background())
+	if !leader {
+		t.Fatal("the first request is not the leader")
+	}
+	f2, leader := g.acquire("a", r2, context.Background())
+	if leader || f2 != f1 {
+		t.Fatal("the request of the same key is not attached to the flight")
+	}
+	if _, leader := g.acquire("b", r3, context.Background()); !leader {
+		t.Fatal("the request of another key is attached to the flight")
+	}
+
+	waiters := g.finish("a", f1)
+	if len(waiters) != 2 {
+		t.Fatalf("finish returns %v waiters, want 2", len(waiters))
+	}
+	if f1.ctx.Err() == nil {
+		t.Error("the flight is not cancelled after finish")
+	}
+	if _, leader := g.acquire("a", r1, context.Background()); !leader {
+		t.Error("the request is attached to a finished flight")
+	}
+}
+
+func TestFlightGroupLeave(t *testing.T) {
+	g := newFlightGroup[*testRequest](time.Minute)
+	r1, r2 := &testRequest{1}, &testRequest{2}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	f, _ := g.acquire("a", r1, ctx1)
+	g.acquire("a", r2, ctx2)
+
+	// the leader gives up, the task keeps running for the other request
+	cancel1()
+	time.Sleep(10 * time.Millisecond)
+	if f.ctx.Err() != nil {
+		t.Fatal("the flight is cancelled while a request is waiting")
+	}
+
+	cancel2()
+	select {
+	case <-f.ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the flight is not cancelled after every request has left")
+	}
+
+	// a cancelled flight is replaced by the next request
+	f3, leader := g.acquire("a", &testRequest{3}, context.Background())
+	if !leader || f3 == f {
+		t.Error("the request is attached to a cancelled flight")
+	}
+}
+
+func TestFlightGroupFinishStopsLeave(t *testing.T) {
+	g := newFlightGroup[*testRequest](time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	f, _ := g.acquire("a", &testRequest{1}, ctx)
+	g.finish("a", f)
+	// the request is resolved already, giving up must not touch the finished flight
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	if f.waiters != nil {
+		t.Error("the finished flight has waiters")
+	}
+}
+
+func TestFlightGroupConcurrent(t *testing.T) {
+	g := newFlightGroup[*testRequest](time.Minute)
+	var leaders atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, leader := g.acquire("a", &testRequest{i}, context.Background()); leader {
+				leaders.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if leaders.Load() != 1 {
+		t.Fatalf("%v leaders, want 1", leaders.Load())
+	}
+	if waiters := g.finish("a", g.calls["a"]); len(waiters) != 64 {
+		t.Errorf("finish returns %v waiters, want 64", len(waiters))
+	}
+}
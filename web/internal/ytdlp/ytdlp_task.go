@@ -2,6 +2,7 @@ package ytdlp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"main/internal/taskq"
 	"os"
@@ -12,8 +13,11 @@ import (
 )
 
 const (
-	TIMEOUT_JSON  = 1 * time.Minute
-	TIMEOUT_AUDIO = 3 * time.Minute
+	TIMEOUT_JSON   = 1 * time.Minute
+	TIMEOUT_AUDIO  = 3 * time.Minute
+	TIMEOUT_SEARCH = 30 * time.Second
+
+	SEARCH_MAX_RESULTS = 10
 )
 
 var (
@@ -60,35 +64,64 @@ type RequestInfojson struct {
 	FinCh    chan struct{}
 	URL      string
 	Response InfoJson
+
+	// optional metadata resolver, DownloadInfoJson() is used if nil
+	Resolve func(context.Context, string) (InfoJson, error)
+
+	key    string                    // in-flight key, set by SubmitInfojson()
+	flight *flight[*RequestInfojson] // set on the request which submitted the task
 }
 
+// the task is shared by the coalesced requests, it runs under the context of the flight
 func (r *RequestInfojson) Process(workerctx context.Context) {
+	if r.flight == nil {
+		log.Error().Str("reqURL", r.URL).Msg("[task] infojson request is not submitted by SubmitInfojson()")
+		r.resolve(InfoJson{}, errors.New("request is not in flight"))
+		return
+	}
+	var json InfoJson
+	var err error
+	defer func() {
+		// share the result with the coalesced requests
+		for _, waiter := range jsonFlight.finish(r.key, r.flight) {
+			go waiter.resolve(json, err)
+		}
+	}()
+
+	ctx := r.flight.ctx
 	select {
 	case <-workerctx.Done():
-		r.ErrCh <- workerctx.Err()
+		err = workerctx.Err()
 		return
-	case <-r.Ctx.Done():
-		r.ErrCh <- r.Ctx.Err()
+	case <-ctx.Done():
+		err = ctx.Err()
 		return
 	default:
-		json, err := DownloadInfoJson(r.Ctx, r.URL)
-		if err != nil {
-			log.Info().Err(err).Msg("[task] failed to fetch infojson")
-			select {
-			case <-r.Ctx.Done():
-				// check closed channel, ctx already timeout on the top-level
-				log.Debug().Msg("[task] ctx already timeout on the top-level")
-				return
-			default:
-			}
-			r.ErrCh <- err
-			return
-		}
+	}
 
-		if workerctx.Err() == nil && r.Ctx.Err() == nil {
-			r.Response = json
-			r.FinCh <- struct{}{}
+	resolve := r.Resolve
+	if resolve == nil {
+		resolve = DownloadInfoJson
+	}
+	json, err = resolve(ctx, r.URL)
+	if err != nil && ctx.Err() == nil {
+		log.Info().Err(err).Msg("[task] failed to fetch infojson")
+	}
+}
+
+// deliver the result without blocking on a caller which has given up
+func (r *RequestInfojson) resolve(json InfoJson, err error) {
+	if err != nil {
+		select {
+		case r.ErrCh <- err:
+		case <-r.Ctx.Done():
 		}
+		return
+	}
+	r.Response = json
+	select {
+	case r.FinCh <- struct{}{}:
+	case <-r.Ctx.Done():
 	}
 }
 
@@ -102,40 +135,130 @@ type RequestAudio struct {
 	FinCh    chan struct{}
 	URL      string
 	Response []byte
+
+	// optional audio fetcher, DownloadAudio() is used if nil
+	Fetch func(context.Context, string) ([]byte, error)
+
+	key    string                 // in-flight key, set by SubmitAudio()
+	flight *flight[*RequestAudio] // set on the request which submitted the task
 }
 
+// the task is shared by the coalesced requests, it runs under the context of the flight
 func (r *RequestAudio) Process(workerctx context.Context) {
+	if r.flight == nil {
+		log.Error().Str("reqURL", r.URL).Msg("[task] audio request is not submitted by SubmitAudio()")
+		r.resolve(nil, errors.New("request is not in flight"))
+		return
+	}
+	var audioBytes []byte
+	var err error
+	defer func() {
+		// share the result with the coalesced requests
+		for _, waiter := range audioFlight.finish(r.key, r.flight) {
+			go waiter.resolve(audioBytes, err)
+		}
+	}()
+
+	ctx := r.flight.ctx
+	select {
+	case <-workerctx.Done():
+		err = workerctx.Err()
+		return
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	default:
+	}
+
+	fetch := r.Fetch
+	if fetch == nil {
+		fetch = DownloadAudio
+	}
+	audioBytes, err = fetch(ctx, r.URL)
+	if err != nil && ctx.Err() == nil {
+		log.Error().Err(err).Msg("[task] failed to fetch audio")
+	}
+}
+
+// deliver the result without blocking on a caller which has given up
+func (r *RequestAudio) resolve(audioBytes []byte, err error) {
+	if err != nil {
+		select {
+		case r.ErrCh <- err:
+		case <-r.Ctx.Done():
+		}
+		return
+	}
+	r.Response = audioBytes
+	select {
+	case r.FinCh <- struct{}{}:
+	case <-r.Ctx.Done():
+	}
+}
+
+func (r *RequestAudio) String() string {
+	return fmt.Sprintf("request: audio, url: %v", r.URL)
+}
+
+type RequestSearch struct {
+	Ctx      context.Context
+	ErrCh    chan error
+	FinCh    chan struct{}
+	Query    string
+	Limit    int
+	Related  bool // Query is the url of a track, search the related tracks of it
+	Response []SearchResult
+}
+
+func (r *RequestSearch) Process(workerctx context.Context) {
 	select {
 	case <-workerctx.Done():
-		r.ErrCh <- workerctx.Err()
+		r.resolve(nil, workerctx.Err())
 		return
 	case <-r.Ctx.Done():
-		r.ErrCh <- r.Ctx.Err()
+		r.resolve(nil, r.Ctx.Err())
 		return
 	default:
-		audioBytes, err := DownloadAudio(r.Ctx, r.URL)
+		var results []SearchResult
+		var err error
+		if r.Related {
+			results, err = DownloadRelated(r.Ctx, r.Query, r.Limit)
+		} else {
+			results, err = DownloadSearch(r.Ctx, r.Query, r.Limit)
+		}
 		if err != nil {
-			log.Error().Err(err).Msg("[task] failed to fetch audio")
-			select {
-			case <-r.Ctx.Done():
-				// check closed channel, ctx already timeout on the top-level
-				log.Debug().Msg("[task] ctx already timeout on the top-level")
-				return
-			default:
-			}
-			r.ErrCh <- err
+			log.Info().Err(err).Msg("[task] failed to search")
+			r.resolve(nil, err)
 			return
 		}
 
 		if workerctx.Err() == nil && r.Ctx.Err() == nil {
-			r.Response = audioBytes
-			r.FinCh <- struct{}{}
+			r.resolve(results, nil)
 		}
 	}
 }
 
-func (r *RequestAudio) String() string {
-	return fmt.Sprintf("request: audio, url: %v", r.URL)
+// deliver the result without blocking on a caller which has given up
+func (r *RequestSearch) resolve(results []SearchResult, err error) {
+	if err != nil {
+		select {
+		case r.ErrCh <- err:
+		case <-r.Ctx.Done():
+		}
+		return
+	}
+	r.Response = results
+	select {
+	case r.FinCh <- struct{}{}:
+	case <-r.Ctx.Done():
+	}
+}
+
+func (r *RequestSearch) String() string {
+	if r.Related {
+		return fmt.Sprintf("request: related, url: %v", r.Query)
+	}
+	return fmt.Sprintf("request: search, query: %v", r.Query)
 }
 
 func init() {
@@ -7,6 +7,7 @@ import threading
 from concurrent.futures import ThreadPoolExecutor
 
 import yt_dlp
+from yt_dlp.extractor.youtube import YoutubeIE
 
 """
 This python application is purely for embedding yt-dlp and socket communication
@@ -29,6 +30,7 @@ def print_env():
 
 # const
 AUDIO_CODEC = 'm4a'
+SEARCH_MAX_RESULTS = 10
 
 
 def dl_infojson(url: str) -> dict:
@@ -67,6 +69,66 @@ def dl_infojson(url: str) -> dict:
     return ret
 
 
+def extract_flat_keys(entry: dict) -> dict:
+    thumbnail = entry.get('thumbnail')
+    if thumbnail is None and entry.get('thumbnails'):
+        thumbnail = entry.get('thumbnails')[-1].get('url')
+    return {
+        'id': entry.get('id'),
+        'url': entry.get('url') or entry.get('webpage_url'),
+        'fulltitle': entry.get('fulltitle') or entry.get('title'),
+        'uploader': entry.get('uploader') or entry.get('channel'),
+        'thumbnail': thumbnail,
+        'duration': int(entry.get('duration') or 0),
+    }
+
+
+def search_infojson(query: str, limit: int) -> list:
+    limit = max(1, min(limit, SEARCH_MAX_RESULTS))
+    ydl_opts = {
+        'quiet': True,
+        'extract_flat': 'in_playlist',
+    }
+    ret = {}
+    try:
+        with yt_dlp.YoutubeDL(ydl_opts) as ydl:
+            infojson = ydl.extract_info(f'ytsearch{limit}:{query}', download=False)
+            infojson = ydl.sanitize_info(infojson)
+            ret = [extract_flat_keys(entry) for entry in infojson.get('entries', []) if entry.get('url') or entry.get('webpage_url')]
+    except Exception as e:
+        ret = {'Err': f'{e}'}
+
+    return ret
+
+
+def related_infojson(url: str, limit: int) -> list:
+    """
+    the related videos are taken from the youtube mix playlist of the video,
+    other sites have no related results
+    """
+    if not YoutubeIE.suitable(url):
+        return []
+
+    limit = max(1, min(limit, SEARCH_MAX_RESULTS))
+    video_id = YoutubeIE._match_id(url)
+    ydl_opts = {
+        'quiet': True,
+        'extract_flat': 'in_playlist',
+        # the first entry is the video itself
+        'playlistend': limit + 1,
+    }
+    ret = {}
+    try:
+        with yt_dlp.YoutubeDL(ydl_opts) as ydl:
+            infojson = ydl.extract_info(f'https://www.youtube.com/watch?v={video_id}&list=RD{video_id}', download=False)
+            infojson = ydl.sanitize_info(infojson)
+            ret = [extract_flat_keys(entry) for entry in infojson.get('entries', []) if entry.get('id') != video_id and (entry.get('url') or entry.get('webpage_url'))]
+    except Exception as e:
+        ret = {'Err': f'{e}'}
+
+    return ret[:limit] if isinstance(ret, list) else ret
+
+
 def dl_audio(url: str):
     buffer = io.BytesIO()
     filepath = ''
@@ -99,7 +161,7 @@ def dl_audio(url: str):
     https://github.com/yt-dlp/yt-dlp/issues/13511#issuecomment-2993001328
     """
     ydl_opts = {
-        'format': 'worstaudio',
+        'format': 'bestaudio/best',
         'extractor_args': {
             'youtube': {
                 'player_client': ['default','-ios'],
@@ -136,6 +198,12 @@ def handle_socket(conn: socket.socket):
         case 'audio':
             resp = dl_audio(url)
             conn.sendall(resp.getvalue())
+        case 'search':
+            resp = search_infojson(url, int(data.get('Limit') or 1))
+            conn.sendall(json.dumps(resp).encode())
+        case 'related':
+            resp = related_infojson(url, int(data.get('Limit') or 1))
+            conn.sendall(json.dumps(resp).encode())
         case _:
             pass
 